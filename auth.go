@@ -0,0 +1,301 @@
+package cogs
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// redactedText replaces every secret found in an error message
+const redactedText = "[REDACTED]"
+
+// authConfig describes where the credentials of an HTTP request are found,
+// it never holds a secret itself: auth = {type = "bearer", token_env = "GH_TOKEN"}
+type authConfig struct {
+	Type        string `mapstructure:"type"`
+	TokenEnv    string `mapstructure:"token_env"`
+	TokenVar    string `mapstructure:"token_var"`
+	User        string `mapstructure:"user"`
+	UserEnv     string `mapstructure:"user_env"`
+	UserVar     string `mapstructure:"user_var"`
+	PasswordEnv string `mapstructure:"password_env"`
+	PasswordVar string `mapstructure:"password_var"`
+	File        string `mapstructure:"file"` // netrc file, $NETRC or ~/.netrc is used if empty
+}
+
+// parseAuth decodes and validates an auth table
+func parseAuth(v interface{}) (*authConfig, error) {
+	rawAuth, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be a table: %T", v)
+	}
+	auth := &authConfig{}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{ErrorUnused: true, Result: auth})
+	if err != nil {
+		return nil, err
+	}
+	if err = decoder.Decode(rawAuth); err != nil {
+		return nil, err
+	}
+
+	count := func(s ...string) int {
+		n := 0
+		for _, el := range s {
+			if el != "" {
+				n++
+			}
+		}
+		return n
+	}
+	switch auth.Type {
+	case "bearer":
+		if count(auth.TokenEnv, auth.TokenVar) != 1 {
+			return nil, fmt.Errorf("bearer auth requires one of token_env or token_var")
+		}
+	case "basic":
+		if count(auth.User, auth.UserEnv, auth.UserVar) != 1 {
+			return nil, fmt.Errorf("basic auth requires one of user, user_env, or user_var")
+		}
+		if count(auth.PasswordEnv, auth.PasswordVar) != 1 {
+			return nil, fmt.Errorf("basic auth requires one of password_env or password_var")
+		}
+	case "netrc":
+	default:
+		return nil, fmt.Errorf("type must be one of: bearer, basic, netrc")
+	}
+	if auth.Type != "netrc" && auth.File != "" {
+		return nil, fmt.Errorf("file is only supported by netrc auth")
+	}
+	return auth, nil
+}
+
+// String describes an authConfig without any secrets so that it can be used to group Links
+func (a *authConfig) String() string {
+	if a == nil {
+		return ""
+	}
+	return fmt.Sprintf("%+v", *a)
+}
+
+// vars returns the names of the Links that an authConfig reads credentials from
+func (a *authConfig) vars() []string {
+	var vars []string
+	if a == nil {
+		return nil
+	}
+	for _, v := range []string{a.TokenVar, a.UserVar, a.PasswordVar} {
+		if v != "" {
+			vars = append(vars, v)
+		}
+	}
+	return vars
+}
+
+// authorize adds the Authorization header described by an authConfig to a Source,
+// every credential used is added to Source.Secrets
+func (g *Gear) authorize(src *Source, auth *authConfig) error {
+	if auth == nil {
+		return nil
+	}
+	credential := func(literal, env, varName string) (string, error) {
+		switch {
+		case literal != "":
+			return literal, nil
+		case env != "":
+			value, ok := os.LookupEnv(env)
+			if !ok || value == "" {
+				return "", fmt.Errorf("auth: environment variable %s is not set", env)
+			}
+			return value, nil
+		}
+		resolved, err := g.referenceValue(varName)
+		if err != nil {
+			return "", fmt.Errorf("auth: %w", err)
+		}
+		value, err := SimpleValueToString(resolved)
+		if err != nil || value == "" {
+			return "", fmt.Errorf("auth: %s does not resolve to a string", varName)
+		}
+		return value, nil
+	}
+
+	var authorization string
+	switch auth.Type {
+	case "bearer":
+		token, err := credential("", auth.TokenEnv, auth.TokenVar)
+		if err != nil {
+			return err
+		}
+		src.Secrets = append(src.Secrets, token)
+		authorization = "Bearer " + token
+	case "basic", "netrc":
+		var user, password string
+		var err error
+		if auth.Type == "netrc" {
+			if user, password, err = g.netrcLogin(src.Path, auth.File); err != nil {
+				return err
+			}
+		} else {
+			if user, err = credential(auth.User, auth.UserEnv, auth.UserVar); err != nil {
+				return err
+			}
+			if password, err = credential("", auth.PasswordEnv, auth.PasswordVar); err != nil {
+				return err
+			}
+		}
+		basic := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+		src.Secrets = append(src.Secrets, password, basic)
+		authorization = "Basic " + basic
+	}
+
+	header := src.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Authorization", authorization)
+	src.Header = header
+	return nil
+}
+
+// netrcLogin returns the login and password of the netrc machine matching the host of a URL,
+// the "default" entry is used if no machine matches
+func (g *Gear) netrcLogin(urlPath, netrcFile string) (login, password string, err error) {
+	u, err := url.Parse(urlPath)
+	if err != nil {
+		return "", "", fmt.Errorf("auth: %w", err)
+	}
+	switch {
+	case netrcFile != "":
+		if netrcFile, err = g.localPath(netrcFile); err != nil {
+			return "", "", fmt.Errorf("auth: %w", err)
+		}
+	case os.Getenv("NETRC") != "":
+		netrcFile = os.Getenv("NETRC")
+	default:
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", fmt.Errorf("auth: %w", err)
+		}
+		netrcFile = filepath.Join(home, ".netrc")
+	}
+
+	file, err := os.Open(netrcFile)
+	if err != nil {
+		return "", "", fmt.Errorf("auth: %w", err)
+	}
+	defer file.Close()
+
+	// entries are a sequence of whitespace separated tokens:
+	// machine <host> login <login> password <password>
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanWords)
+	var tokens []string
+	for scanner.Scan() {
+		tokens = append(tokens, scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		return "", "", fmt.Errorf("auth: %s: %w", netrcFile, err)
+	}
+
+	type entry struct{ login, password string }
+	var found, fallback *entry
+	var current *entry
+	for i := 0; i < len(tokens); i++ {
+		next := func() string {
+			if i+1 < len(tokens) {
+				i++
+				return tokens[i]
+			}
+			return ""
+		}
+		switch tokens[i] {
+		case "machine":
+			current = &entry{}
+			if next() == u.Hostname() && found == nil {
+				found = current
+			}
+		case "default":
+			current = &entry{}
+			fallback = current
+		case "login":
+			if current != nil {
+				current.login = next()
+			}
+		case "password":
+			if current != nil {
+				current.password = next()
+			}
+		}
+	}
+	if found == nil {
+		found = fallback
+	}
+	if found == nil {
+		return "", "", fmt.Errorf("auth: %s has no entry for %s", netrcFile, u.Hostname())
+	}
+	return found.login, found.password, nil
+}
+
+// redactedError hides secrets from the message of an error while keeping the error chain
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redact removes the secrets of a Source, including any password held by its URL, from an error message
+func redact(err error, src *Source) error {
+	if err == nil {
+		return nil
+	}
+	msg := redactSecrets(err.Error(), sourceSecrets(src))
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+// sourceSecrets returns Source.Secrets and the password of the Source URL,
+// longer secrets come first so that a secret containing another is fully redacted
+func sourceSecrets(src *Source) []string {
+	secrets := append([]string{}, src.Secrets...)
+	if u, err := url.Parse(src.Path); err == nil && u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			// the HTTP client sends the userinfo of a URL as a basic Authorization header
+			basic := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+			secrets = append(secrets, password, url.QueryEscape(password), basic)
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	return secrets
+}
+
+// redactSecrets replaces every secret found in s
+func redactSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redactedText)
+		}
+	}
+	return s
+}
+
+// redactURL hides the password of a URL
+func redactURL(urlPath string) string {
+	u, err := url.Parse(urlPath)
+	if err != nil || u.User == nil {
+		return urlPath
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,261 @@
+package cogs
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// requestBody holds the body of an HTTP request before %{key_name} references are substituted,
+// at most one of text, data, form, or file is defined
+type requestBody struct {
+	text        string                 // string body, sent as JSON unless contentType is set
+	data        map[string]interface{} // table body, encoded as JSON
+	form        map[string]interface{} // form values, encoded as application/x-www-form-urlencoded
+	file        string                 // file holding the body, relative to the cog file
+	contentType string                 // Content-Type of the request
+}
+
+// bodyKeys are the keys that define the payload of a requestBody
+var bodyKeys = []string{"body", "form", "body_file"}
+
+// parseKey decodes one of the body, form, body_file, or content_type keys into a requestBody
+func (b *requestBody) parseKey(k string, v interface{}) error {
+	var ok bool
+	switch k {
+	case "body":
+		switch body := v.(type) {
+		case string:
+			b.text = body
+		case map[string]interface{}:
+			b.data = body
+		default:
+			return fmt.Errorf("must be a string or a table: %T", v)
+		}
+	case "form":
+		if b.form, ok = v.(map[string]interface{}); !ok {
+			return fmt.Errorf("must be a table: %T", v)
+		}
+		for name, value := range b.form {
+			if !IsSimpleValue(value) {
+				return fmt.Errorf("%s: %T is an unsupported type", name, value)
+			}
+		}
+	case "body_file":
+		if b.file, ok = v.(string); !ok || b.file == "" {
+			return fmt.Errorf("must be a non-empty string")
+		}
+	case "content_type":
+		if b.contentType, ok = v.(string); !ok {
+			return fmt.Errorf("must be a string: %T", v)
+		}
+		if _, _, err := mime.ParseMediaType(b.contentType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inherit assigns the payload and Content-Type of base that were not defined by rawLink
+func (b *requestBody) inherit(base requestBody, rawLink map[string]interface{}) {
+	definesPayload := false
+	for _, k := range bodyKeys {
+		if _, ok := rawLink[k]; ok {
+			definesPayload = true
+		}
+	}
+	if !definesPayload {
+		b.text, b.data, b.form, b.file = base.text, base.data, base.form, base.file
+	}
+	if _, ok := rawLink["content_type"]; !ok {
+		b.contentType = base.contentType
+	}
+}
+
+// validate ensures that a single payload is defined
+func (b requestBody) validate() error {
+	defined := 0
+	for _, ok := range []bool{b.text != "", b.data != nil, b.form != nil, b.file != ""} {
+		if ok {
+			defined++
+		}
+	}
+	if defined > 1 {
+		return fmt.Errorf("only one of %s can be defined", strings.Join(bodyKeys, ", "))
+	}
+	return nil
+}
+
+// String describes a requestBody so that Links are grouped by the request they make,
+// the fmt package prints maps in key-sorted order
+func (b requestBody) String() string {
+	if b.data == nil && b.form == nil {
+		return fmt.Sprintf("%q %q %q", b.text, b.file, b.contentType)
+	}
+	return fmt.Sprintf("%q %v %v %q", b.text, b.data, b.form, b.contentType)
+}
+
+// refs returns the %{key_name} references held by a requestBody,
+// the contents of a body file are only known once read into requestBody.text
+func (b requestBody) refs() []string {
+	var refs []string
+	var collect func(v interface{})
+	collect = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			refs = append(refs, referenceNames(v)...)
+		case map[string]interface{}:
+			for _, el := range v {
+				collect(el)
+			}
+		case []interface{}:
+			for _, el := range v {
+				collect(el)
+			}
+		}
+	}
+	collect(b.text)
+	collect(b.data)
+	collect(b.form)
+	sort.Strings(refs)
+	return refs
+}
+
+// readFile reads the file of a body_file into requestBody.text
+func (b *requestBody) readFile(g *Gear) error {
+	if b.file == "" {
+		return nil
+	}
+	filePath, err := g.localPath(b.file)
+	if err != nil {
+		return fmt.Errorf("body_file: %w", err)
+	}
+	buf, err := readFile(filePath)
+	if err != nil {
+		return fmt.Errorf("body_file: %w", err)
+	}
+	b.text = string(buf)
+	return nil
+}
+
+// render substitutes the %{key_name} references of a requestBody with resolved Link values,
+// returning the encoded body and its Content-Type.
+// An empty Content-Type is returned for string bodies that are sent as JSON
+func (g *Gear) render(b requestBody) (string, string, error) {
+	contentType := b.contentType
+	switch {
+	case b.data != nil:
+		data, err := g.substitute(b.data)
+		if err != nil {
+			return "", "", err
+		}
+		buf, err := json.Marshal(data)
+		if err != nil {
+			return "", "", fmt.Errorf("body: %w", err)
+		}
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		return string(buf), contentType, nil
+	case b.form != nil:
+		form, err := g.substitute(b.form)
+		if err != nil {
+			return "", "", err
+		}
+		values := make(url.Values)
+		for name, value := range form.(map[string]interface{}) {
+			str, err := SimpleValueToString(value)
+			if err != nil {
+				return "", "", fmt.Errorf("form.%s: %w", name, err)
+			}
+			values.Set(name, str)
+		}
+		if contentType == "" {
+			contentType = "application/x-www-form-urlencoded"
+		}
+		return values.Encode(), contentType, nil
+	}
+
+	text, err := g.substitute(b.text)
+	if err != nil {
+		return "", "", err
+	}
+	if b.file != "" && contentType == "" {
+		if contentType = mime.TypeByExtension(filepath.Ext(b.file)); contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+	return text.(string), contentType, nil
+}
+
+// substitute replaces the %{key_name} references found in the strings of v,
+// a string holding a single reference is replaced by the referenced value itself
+func (g *Gear) substitute(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		if match := interpolationRe.FindStringSubmatch(v); match != nil && match[0] == v && v != "%%{" {
+			return g.referenceValue(strings.TrimSpace(match[1]))
+		}
+		var err error
+		str := interpolationRe.ReplaceAllStringFunc(v, func(match string) string {
+			if err != nil {
+				return match
+			}
+			if match == "%%{" {
+				return "%{"
+			}
+			var value interface{}
+			if value, err = g.referenceValue(strings.TrimSpace(interpolationRe.FindStringSubmatch(match)[1])); err != nil {
+				return match
+			}
+			var str string
+			str, err = SimpleValueToString(value)
+			return str
+		})
+		return str, err
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, el := range v {
+			var err error
+			if m[k], err = g.substitute(el); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		slice := make([]interface{}, len(v))
+		for i, el := range v {
+			var err error
+			if slice[i], err = g.substitute(el); err != nil {
+				return nil, err
+			}
+		}
+		return slice, nil
+	}
+	return v, nil
+}
+
+// referenceValue returns the resolved value of another Link of the context,
+// the value is read before transforms are applied to every resolved Link so they are applied to a copy
+func (g *Gear) referenceValue(name string) (interface{}, error) {
+	link, ok := g.linkMap[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown reference %q", name)
+	}
+	// literal values are interpolated once every request has been made
+	if str, ok := link.Value.(string); ok && isInterpolated(link) && interpolationRe.MatchString(str) {
+		return nil, fmt.Errorf("reference %q: a value holding references cannot be referenced by a request", name)
+	}
+	if link.Value == nil {
+		return nil, fmt.Errorf("reference %q: value is not resolved", name)
+	}
+	resolved := *link
+	if err := applyTransforms(&resolved); err != nil {
+		return nil, fmt.Errorf("reference %q: %w", name, err)
+	}
+	return resolved.Value, nil
+}
@@ -0,0 +1,114 @@
+package cogs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// httpCache stores the responses of HTTP GET requests on disk,
+// responses are stored as they were received so encrypted documents are only cached as ciphertext
+type httpCache struct {
+	dir     string
+	ttl     time.Duration // entries younger than the ttl are used without revalidation
+	offline bool          // only cached entries are used
+}
+
+// cacheEntry is a cached HTTP response
+type cacheEntry struct {
+	URL          string    `json:"url"` // URL without its password, kept to ease inspection
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	Stored       time.Time `json:"stored"`
+	Data         []byte    `json:"data"`
+}
+
+// isCacheable returns true if the response of a Source can be cached
+func isCacheable(src *Source) bool {
+	return src.Method == "" || src.Method == http.MethodGet
+}
+
+// cacheKey hashes every property of a request that can change its response
+func cacheKey(src *Source) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n", src.Method, src.Path, src.ContentType, src.Body)
+	keys := Keys(src.Header)
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s: %s\n", k, strings.Join(src.Header[k], ", "))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns the entry stored under a key, unreadable entries are treated as missing
+func (c *httpCache) get(key string) *cacheEntry {
+	b, err := os.ReadFile(filepath.Join(c.dir, key+".json"))
+	if err != nil {
+		return nil
+	}
+	entry := &cacheEntry{}
+	if err = json.Unmarshal(b, entry); err != nil {
+		return nil
+	}
+	return entry
+}
+
+// put atomically stores an entry under a key
+func (c *httpCache) put(key string, entry *cacheEntry) error {
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return fmt.Errorf("cache: %w", err)
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cache: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("cache: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(c.dir, key+".json")); err != nil {
+		return fmt.Errorf("cache: %w", err)
+	}
+	return nil
+}
+
+// fresh returns true if an entry can be used without revalidation
+func (e *cacheEntry) fresh(ttl time.Duration) bool {
+	return ttl > 0 && time.Since(e.Stored) < ttl
+}
+
+// conditional adds the revalidation headers of an entry to a copy of header
+func (e *cacheEntry) conditional(header http.Header) http.Header {
+	header = header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if e.ETag != "" {
+		header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		header.Set("If-Modified-Since", e.LastModified)
+	}
+	return header
+}
+
+// document returns the Document held by an entry
+func (e *cacheEntry) document() *Document {
+	return &Document{Data: e.Data, Format: formatForContentType(e.ContentType)}
+}
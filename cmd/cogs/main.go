@@ -22,6 +22,8 @@ COGS COnfiguration manaGement S
 
 Usage:
   cogs gen <cog-file> <ctx>... [options]
+  cogs schema <cog-file> <ctx>... [options]
+  cogs lock <cog-file> <ctx>... [options]
 
 Options:
   -h --help        Show this screen.
@@ -31,29 +33,64 @@ Options:
   --envsubst, -e   Perform environmental substitution on the given cog file.
   --keys=<key,>    Include specific keys, comma separated.
   --not=<key,>     Exclude specific keys, comma separated.
+  --merge=<strat>  Duplicate key handling across contexts [default: error].
+                   <strat>: error, first, last, deep.
+  --schema=<file>  Validate the generated config against a JSON Schema file.
+  --allow-exec=<cmd,>  Allow cmd:// paths to run the given commands, comma separated.
+                       Commands without a timeout key are stopped after 30s.
+  --concurrency=<n>    Number of paths loaded at once, including nested gears, defaults to 8.
+  --cache-dir=<dir>    Cache HTTP GET responses in <dir>, encrypted files are cached as ciphertext.
+  --cache-ttl=<dur>    Use cached responses younger than <dur> without revalidating them, e.g. 10m.
+  --offline            Only use cached responses, requires --cache-dir.
+  --record=<dir>       Record every HTTP exchange to <dir>, auth credentials are redacted.
+  --replay=<dir>       Serve HTTP exchanges recorded to <dir> without making requests.
+  --locked             Fail if a source changed since it was pinned by "cogs lock".
+  --root=<dir>         Fail if a local path resolves outside of <dir>, symlinks included. Rejects cmd:// and git:// paths.
+  --allow-url=<host,>  Only request HTTP hosts matching the given glob patterns, comma separated.
+  --age-key-file=<file>  Decrypt with the age identities of <file> instead of SOPS_AGE_KEY_FILE.
+  --pgp-keyring=<file>   Decrypt with the private keys of <file> instead of GNUPGHOME and gpg.
   --out=<type>     Configuration output type [default: json].
                    <type>: json, toml, yaml, dotenv, list.
   
   --export, -x     If --out=dotenv: Prepends "export " to each line.
   --preserve, -p   If --out=dotenv: Preserves variable casing.
   --sep=<sep>      If --out=list:   Delimits values with a <sep>arator.
+  
+  --go=<struct>    If schema: Outputs a Go struct named <struct> instead of a JSON Schema.
  `
 
 // Conf is used to bind CLI arguments and options
 type Conf struct {
-	Gen       bool
-	Ctx       []string
-	File      string `docopt:"<cog-file>"`
-	Output    string `docopt:"--out"`
-	Keys      string
-	Not       string
-	NoEnc     bool
-	NoDecrypt bool
-	Raw       bool
-	EnvSubst  bool `docopt:"--envsubst"`
-	Export    bool
-	Preserve  bool
-	Delimiter string `docopt:"--sep"`
+	Gen         bool
+	Schema      bool
+	Lock        bool
+	Ctx         []string
+	File        string `docopt:"<cog-file>"`
+	Output      string `docopt:"--out"`
+	Keys        string
+	Not         string
+	Merge       string
+	SchemaFile  string `docopt:"--schema"`
+	GoStruct    string `docopt:"--go"`
+	AllowExec   string
+	Concurrency string
+	CacheDir    string `docopt:"--cache-dir"`
+	CacheTTL    string `docopt:"--cache-ttl"`
+	Offline     bool
+	Record      string
+	Replay      string
+	Locked      bool
+	Root        string
+	AllowURL    string `docopt:"--allow-url"`
+	AgeKeyFile  string `docopt:"--age-key-file"`
+	PGPKeyring  string `docopt:"--pgp-keyring"`
+	NoEnc       bool
+	NoDecrypt   bool
+	Raw         bool
+	EnvSubst    bool `docopt:"--envsubst"`
+	Export      bool
+	Preserve    bool
+	Delimiter   string `docopt:"--sep"`
 }
 
 var conf Conf
@@ -79,37 +116,47 @@ func run() error {
 	}
 	// this is the logger used by yq, set it to warning to hide trace and debug data
 	logging.SetLevel(logging.WARNING, "")
-	cogs.NoEnc = conf.NoEnc
-	cogs.EnvSubst = conf.EnvSubst
-	cogs.NoDecrypt = conf.NoDecrypt
 
-	if cogs.NoDecrypt && cogs.NoEnc {
+	if conf.NoDecrypt && conf.NoEnc {
 		return cogs.ErrNoEncAndNoDecrypt
 	}
 
+	format, err := conf.validate()
+	if err != nil {
+		return err
+	}
+	strategy := cogs.MergeStrategy(conf.Merge)
+	gen := conf.generator(format)
+	if conf.Locked {
+		if gen.Lock, err = cogs.ReadLockfile(cogs.LockfilePath(conf.File)); err != nil {
+			return fmt.Errorf("--locked: %w", err)
+		}
+	}
+
 	switch {
 	case conf.Gen:
 		var b []byte
 		var output string
-		var cfgs []*cogs.CfgMap
 		var cfgMap cogs.CfgMap
 
-		format, err := conf.validate()
+		cfgs, raws, links, err := generate(gen)
 		if err != nil {
 			return err
 		}
-
-		for _, ctx := range conf.Ctx {
-			cfg, err := cogs.Generate(ctx, conf.File, format, conf.filterLinks)
+		// values are validated before they are converted to the output type
+		if conf.SchemaFile != "" {
+			rawMap, err := cogs.JoinWith(strategy, raws...)
 			if err != nil {
 				return err
 			}
-			cfgs = append(cfgs, &cfg)
+			if err = cogs.ValidateSchema(conf.SchemaFile, rawMap, links); err != nil {
+				return err
+			}
 		}
 		// Dotenv Join should be done once modFn changes key names so that
 		// keyName and key_name can be marked as duplicates of KEY_NAME
 		if format != cogs.Dotenv {
-			if cfgMap, err = cogs.Join(cfgs...); err != nil {
+			if cfgMap, err = cogs.JoinWith(strategy, cfgs...); err != nil {
 				return err
 			}
 		}
@@ -121,7 +168,7 @@ func run() error {
 		case cogs.YAML:
 			b, err = yaml.Marshal(cfgMap)
 			output = string(b)
-			if cogs.GoTemplateDelimPresent {
+			if gen.GoTemplateDelimPresent() {
 				output = cogs.StripGoTemplateDelim(output)
 			}
 		case cogs.TOML:
@@ -140,7 +187,7 @@ func run() error {
 			for _, cfg := range cfgs {
 				*cfg = modKeys(*cfg, modFn...)
 			}
-			if cfgMap, err = cogs.Join(cfgs...); err != nil {
+			if cfgMap, err = cogs.JoinWith(strategy, cfgs...); err != nil {
 				return err
 			}
 
@@ -158,7 +205,84 @@ func run() error {
 		}
 
 		fmt.Fprint(os.Stdout, output)
+	case conf.Schema:
+		var output string
+
+		cfgs, _, links, err := generate(gen)
+		if err != nil {
+			return err
+		}
+		cfgMap, err := cogs.JoinWith(strategy, cfgs...)
+		if err != nil {
+			return err
+		}
+
+		schema := cogs.InferSchema(cfgMap, links)
+		if conf.GoStruct != "" {
+			output, err = cogs.GoStruct(conf.GoStruct, schema)
+		} else {
+			var b []byte
+			b, err = json.MarshalIndent(schema, "", "  ")
+			output = string(b) + "\n"
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprint(os.Stdout, output)
+	case conf.Lock:
+		if _, _, _, err = generate(gen); err != nil {
+			return err
+		}
+		// contexts that were not passed keep their locked hashes
+		lockPath := cogs.LockfilePath(conf.File)
+		lock, err := cogs.ReadLockfile(lockPath)
+		if os.IsNotExist(errors.Cause(err)) {
+			lock, err = gen.Lockfile(), nil
+		}
+		if err != nil {
+			return err
+		}
+		lock.Merge(gen.Lockfile())
+		if err = lock.Write(lockPath); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, lockPath)
 	}
 
 	return nil
 }
+
+// generate returns the CfgMap of every context passed to the CLI, the same CfgMaps holding
+// resolved values before their conversion to the output type, and every filtered Link
+// so that a key can be traced back to where it was resolved from
+func generate(gen *cogs.Generator) (cfgs, raws []*cogs.CfgMap, links map[string]*cogs.Link, err error) {
+	links = make(map[string]*cogs.Link)
+	var ctxLinks map[string]*cogs.Link
+	gen.Filter = func(linkMap map[string]*cogs.Link) (map[string]*cogs.Link, error) {
+		linkMap, err := conf.filterLinks(linkMap)
+		for k, link := range linkMap {
+			links[k] = link
+			ctxLinks[k] = link
+		}
+		return linkMap, err
+	}
+
+	for _, ctx := range conf.Ctx {
+		ctxLinks = make(map[string]*cogs.Link)
+		cfg, err := gen.Generate(ctx, conf.File)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		raw := make(cogs.CfgMap)
+		for k, v := range cfg {
+			raw[k] = v
+			if link, ok := ctxLinks[k]; ok {
+				raw[k] = link.Value
+			}
+		}
+		cfgs = append(cfgs, &cfg)
+		raws = append(raws, &raw)
+	}
+	return cfgs, raws, links, nil
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mkatychev/cogs"
 )
@@ -96,13 +98,64 @@ func (c *Conf) filterLinks(linkMap map[string]*cogs.Link) (map[string]*cogs.Link
 	return newCfgMap, nil
 }
 
+// generator returns a cogs.Generator configured by the CLI options
+func (c *Conf) generator(format cogs.Format) *cogs.Generator {
+	gen := cogs.NewGenerator()
+	gen.NoEnc = c.NoEnc
+	gen.NoDecrypt = c.NoDecrypt
+	gen.EnvSubst = c.EnvSubst
+	gen.OutputType = format
+	if c.AllowExec != "" {
+		gen.AllowExec = strings.Split(c.AllowExec, ",")
+	}
+	// validated by Conf.validate
+	gen.Concurrency, _ = strconv.Atoi(c.Concurrency)
+	gen.CacheDir = c.CacheDir
+	gen.CacheTTL, _ = time.ParseDuration(c.CacheTTL)
+	gen.Offline = c.Offline
+	gen.Record = c.Record
+	gen.Replay = c.Replay
+	gen.Root = c.Root
+	gen.AgeKeyFile = c.AgeKeyFile
+	gen.PGPKeyring = c.PGPKeyring
+	if c.AllowURL != "" {
+		gen.AllowURL = strings.Split(c.AllowURL, ",")
+	}
+	return gen
+}
+
 func (c *Conf) validate() (format cogs.Format, err error) {
+	if cogs.MergeStrategy(c.Merge).Validate() != nil {
+		return "", fmt.Errorf("invalid opt: --merge=" + c.Merge)
+	}
+	if n, err := strconv.Atoi(c.Concurrency); c.Concurrency != "" && (err != nil || n < 1) {
+		return "", fmt.Errorf("invalid opt: --concurrency=" + c.Concurrency)
+	}
+	if ttl, err := time.ParseDuration(c.CacheTTL); c.CacheTTL != "" && (err != nil || ttl < 0) {
+		return "", fmt.Errorf("invalid opt: --cache-ttl=" + c.CacheTTL)
+	}
+	if c.CacheDir == "" && (c.CacheTTL != "" || c.Offline) {
+		return "", fmt.Errorf("invalid opt: --cache-ttl and --offline require --cache-dir")
+	}
+	if c.Record != "" && c.Replay != "" {
+		return "", fmt.Errorf("invalid opt: --record and --replay cannot both be set")
+	}
+	if c.Locked && !c.Gen {
+		return "", fmt.Errorf("invalid opt: --locked")
+	}
+	// schema inference relies on the unmarshalled value types
+	if c.Schema || c.Lock {
+		return cogs.JSON, nil
+	}
 	if !c.Gen {
 		return "", nil
 	}
 	if format = cogs.Format(conf.Output); format.Validate() != nil {
 		return "", fmt.Errorf("invalid opt: --out=" + conf.Output)
 	}
+	if c.GoStruct != "" {
+		return "", fmt.Errorf("invalid opt: --go")
+	}
 
 	switch {
 	case format != cogs.List:
@@ -0,0 +1,223 @@
+package cogs
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// constraints holds the validation rules checked against a resolved Link.Value
+type constraints struct {
+	pattern   *regexp.Regexp
+	enum      []interface{}
+	min       *float64
+	max       *float64
+	minLength *int
+	maxLength *int
+	format    string // string format of the format or string_format constraint
+}
+
+// valid string formats for the `format` and `string_format` constraints
+var constraintFormats = []string{"url", "email", "hostname", "ip"}
+
+// hostnameRe matches RFC 1123 hostnames
+var hostnameRe = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// isConstraintKey returns true if a link key name corresponds to a validation constraint
+func isConstraintKey(k string) bool {
+	switch k {
+	case "pattern", "enum", "min", "max", "min_length", "max_length", "string_format":
+		return true
+	}
+	return false
+}
+
+// parseConstraint decodes a single constraint key into the Link's constraints
+func (c *Link) parseConstraint(k string, v interface{}) error {
+	var err error
+	if c.constraints == nil {
+		c.constraints = &constraints{}
+	}
+	cs := c.constraints
+
+	switch k {
+	case "pattern":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("must be a string")
+		}
+		if cs.pattern, err = regexp.Compile(str); err != nil {
+			return err
+		}
+	case "enum":
+		slice, ok := v.([]interface{})
+		if !ok || len(slice) == 0 {
+			return fmt.Errorf("must be a non-empty array of simple values")
+		}
+		for _, el := range slice {
+			if !IsSimpleValue(el) {
+				return fmt.Errorf("must be a non-empty array of simple values")
+			}
+		}
+		cs.enum = slice
+	case "min", "max":
+		// numeric strings are only accepted as values, not as bounds
+		_, isString := v.(string)
+		f, ok := toFloat(v)
+		if !ok || isString {
+			return fmt.Errorf("must be a number")
+		}
+		if k == "min" {
+			cs.min = &f
+		} else {
+			cs.max = &f
+		}
+	case "min_length", "max_length":
+		i, ok := v.(int64)
+		if !ok || i < 0 {
+			return fmt.Errorf("must be a non-negative integer")
+		}
+		n := int(i)
+		if k == "min_length" {
+			cs.minLength = &n
+		} else {
+			cs.maxLength = &n
+		}
+	case "string_format":
+		str, ok := v.(string)
+		if !ok || !InList(str, constraintFormats) {
+			return fmt.Errorf("must be one of: %s", strings.Join(constraintFormats, ", "))
+		}
+		cs.format = str
+	}
+	return nil
+}
+
+// validate returns every constraint violation of a given value
+func (cs *constraints) validate(v interface{}) []string {
+	var violations []string
+	if cs == nil || v == nil {
+		return nil
+	}
+
+	if cs.enum != nil {
+		found := false
+		for _, el := range cs.enum {
+			if fmt.Sprint(el) == fmt.Sprint(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			violations = append(violations, fmt.Sprintf("value %v is not one of %v", v, cs.enum))
+		}
+	}
+
+	if cs.min != nil || cs.max != nil {
+		f, ok := toFloat(v)
+		switch {
+		case !ok:
+			violations = append(violations, fmt.Sprintf("value %v is not a number", v))
+		case cs.min != nil && f < *cs.min:
+			violations = append(violations, fmt.Sprintf("value %v is less than min %v", v, *cs.min))
+		case cs.max != nil && f > *cs.max:
+			violations = append(violations, fmt.Sprintf("value %v is greater than max %v", v, *cs.max))
+		}
+	}
+
+	if cs.pattern == nil && cs.minLength == nil && cs.maxLength == nil && cs.format == "" {
+		return violations
+	}
+	str, err := SimpleValueToString(v)
+	if err != nil {
+		return append(violations, fmt.Sprintf("value of type %T is not a simple value", v))
+	}
+	if cs.pattern != nil && !cs.pattern.MatchString(str) {
+		violations = append(violations, fmt.Sprintf("value %q does not match pattern %q", str, cs.pattern))
+	}
+	length := utf8.RuneCountInString(str)
+	if cs.minLength != nil && length < *cs.minLength {
+		violations = append(violations, fmt.Sprintf("length %d is less than min_length %d", length, *cs.minLength))
+	}
+	if cs.maxLength != nil && length > *cs.maxLength {
+		violations = append(violations, fmt.Sprintf("length %d is greater than max_length %d", length, *cs.maxLength))
+	}
+	if cs.format != "" && !isFormat(cs.format, str) {
+		violations = append(violations, fmt.Sprintf("value %q is not a valid %s", str, cs.format))
+	}
+	return violations
+}
+
+// isFormat checks that a string satisfies one of the constraintFormats
+func isFormat(format, str string) bool {
+	switch format {
+	case "url":
+		u, err := url.Parse(str)
+		return err == nil && u.Scheme != "" && u.Host != ""
+	case "email":
+		addr, err := mail.ParseAddress(str)
+		return err == nil && addr.Address == str
+	case "hostname":
+		return len(str) <= 253 && hostnameRe.MatchString(str)
+	case "ip":
+		return net.ParseIP(str) != nil
+	}
+	return false
+}
+
+// toFloat converts numeric values and numeric strings to a float64
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case int:
+		return float64(t), true
+	case int8:
+		return float64(t), true
+	case int16:
+		return float64(t), true
+	case int32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case uint:
+		return float64(t), true
+	case uint8:
+		return float64(t), true
+	case uint16:
+		return float64(t), true
+	case uint32:
+		return float64(t), true
+	case uint64:
+		return float64(t), true
+	case float32:
+		return float64(t), true
+	case float64:
+		return t, true
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// validateLinks checks the constraints of every Link in a link map,
+// violations are grouped by key name in the same fashion as visitor.Errors
+func validateLinks(linkMap map[string]*Link) []error {
+	var errs []error
+	keys := Keys(linkMap)
+	sort.Strings(keys)
+	for _, k := range keys {
+		link := linkMap[k]
+		violations := link.constraints.validate(link.Value)
+		if len(violations) == 0 {
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s:\n      %s", k, strings.Join(violations, "\n      ")))
+	}
+	return errs
+}
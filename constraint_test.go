@@ -0,0 +1,227 @@
+package cogs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseConstraint(t *testing.T) {
+	testCases := []struct {
+		name  string
+		key   string
+		value interface{}
+		err   error
+	}{
+		{name: "Pattern", key: "pattern", value: `^[a-z]+$`},
+		{name: "Enum", key: "enum", value: []interface{}{"dev", int64(1)}},
+		{name: "Min", key: "min", value: int64(1)},
+		{name: "MaxFloat", key: "max", value: 1.5},
+		{name: "MinLength", key: "min_length", value: int64(0)},
+		{name: "MaxLength", key: "max_length", value: int64(8)},
+		{name: "Format", key: "string_format", value: "email"},
+		{
+			name:  "InvalidPattern/Error",
+			key:   "pattern",
+			value: `^[a-z+$`,
+			err:   fmt.Errorf("error parsing regexp: missing closing ]: `[a-z+$`"),
+		},
+		{
+			name:  "NonStringPattern/Error",
+			key:   "pattern",
+			value: int64(1),
+			err:   fmt.Errorf("must be a string"),
+		},
+		{
+			name:  "EmptyEnum/Error",
+			key:   "enum",
+			value: []interface{}{},
+			err:   fmt.Errorf("must be a non-empty array of simple values"),
+		},
+		{
+			name:  "ComplexEnum/Error",
+			key:   "enum",
+			value: []interface{}{map[string]interface{}{}},
+			err:   fmt.Errorf("must be a non-empty array of simple values"),
+		},
+		{
+			name:  "NonNumericMin/Error",
+			key:   "min",
+			value: "ten",
+			err:   fmt.Errorf("must be a number"),
+		},
+		{
+			name:  "NumericStringMin/Error",
+			key:   "min",
+			value: "10",
+			err:   fmt.Errorf("must be a number"),
+		},
+		{
+			name:  "NonNumericMax/Error",
+			key:   "max",
+			value: true,
+			err:   fmt.Errorf("must be a number"),
+		},
+		{
+			name:  "NegativeMinLength/Error",
+			key:   "min_length",
+			value: int64(-1),
+			err:   fmt.Errorf("must be a non-negative integer"),
+		},
+		{
+			name:  "FloatMaxLength/Error",
+			key:   "max_length",
+			value: 2.5,
+			err:   fmt.Errorf("must be a non-negative integer"),
+		},
+		{
+			name:  "UnknownFormat/Error",
+			key:   "string_format",
+			value: "uuid",
+			err:   fmt.Errorf("must be one of: url, email, hostname, ip"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			link := &Link{KeyName: "var"}
+			err := link.parseConstraint(tc.key, tc.value)
+			if diff := cmp.Diff(fmt.Sprint(tc.err), fmt.Sprint(err)); diff != "" {
+				t.Errorf("(-expected err +actual err)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateLinks(t *testing.T) {
+	testCases := []struct {
+		name        string
+		constraints map[string]interface{}
+		value       interface{}
+		err         error
+	}{
+		{
+			name:        "Pattern",
+			constraints: map[string]interface{}{"pattern": `^v\d+$`},
+			value:       "v12",
+		},
+		{
+			name:        "Pattern/Error",
+			constraints: map[string]interface{}{"pattern": `^v\d+$`},
+			value:       "12",
+			err:         fmt.Errorf("var:\n      value \"12\" does not match pattern \"^v\\\\d+$\""),
+		},
+		{
+			name:        "Enum",
+			constraints: map[string]interface{}{"enum": []interface{}{"dev", "prod"}},
+			value:       "prod",
+		},
+		{
+			name:        "EnumNumber",
+			constraints: map[string]interface{}{"enum": []interface{}{int64(80), int64(443)}},
+			value:       int64(443),
+		},
+		{
+			name:        "Enum/Error",
+			constraints: map[string]interface{}{"enum": []interface{}{"dev", "prod"}},
+			value:       "qa",
+			err:         fmt.Errorf("var:\n      value qa is not one of [dev prod]"),
+		},
+		{
+			name:        "MinMax",
+			constraints: map[string]interface{}{"min": int64(1024), "max": int64(65535)},
+			value:       int64(8080),
+		},
+		{
+			name:        "NumericString",
+			constraints: map[string]interface{}{"min": int64(1024)},
+			value:       "8080",
+		},
+		{
+			name:        "Min/Error",
+			constraints: map[string]interface{}{"min": int64(1024)},
+			value:       int64(80),
+			err:         fmt.Errorf("var:\n      value 80 is less than min 1024"),
+		},
+		{
+			name:        "Max/Error",
+			constraints: map[string]interface{}{"max": 1.5},
+			value:       2.5,
+			err:         fmt.Errorf("var:\n      value 2.5 is greater than max 1.5"),
+		},
+		{
+			name:        "NotANumber/Error",
+			constraints: map[string]interface{}{"min": int64(1)},
+			value:       "one",
+			err:         fmt.Errorf("var:\n      value one is not a number"),
+		},
+		{
+			name:        "Length",
+			constraints: map[string]interface{}{"min_length": int64(2), "max_length": int64(4)},
+			value:       "héé",
+		},
+		{
+			name:        "Length/Error",
+			constraints: map[string]interface{}{"min_length": int64(4), "max_length": int64(2)},
+			value:       "abc",
+			err: fmt.Errorf("var:\n      length 3 is less than min_length 4\n" +
+				"      length 3 is greater than max_length 2"),
+		},
+		{
+			name:        "ComplexValue/Error",
+			constraints: map[string]interface{}{"max_length": int64(2)},
+			value:       []interface{}{"a"},
+			err:         fmt.Errorf("var:\n      value of type []interface {} is not a simple value"),
+		},
+		{name: "URL", constraints: map[string]interface{}{"string_format": "url"}, value: "https://example.com/path"},
+		{
+			name:        "URL/Error",
+			constraints: map[string]interface{}{"string_format": "url"},
+			value:       "example.com/path",
+			err:         fmt.Errorf("var:\n      value \"example.com/path\" is not a valid url"),
+		},
+		{name: "Email", constraints: map[string]interface{}{"string_format": "email"}, value: "admin@example.com"},
+		{
+			name:        "Email/Error",
+			constraints: map[string]interface{}{"string_format": "email"},
+			value:       "Admin <admin@example.com>",
+			err:         fmt.Errorf("var:\n      value \"Admin <admin@example.com>\" is not a valid email"),
+		},
+		{name: "Hostname", constraints: map[string]interface{}{"string_format": "hostname"}, value: "api-1.example.com"},
+		{
+			name:        "Hostname/Error",
+			constraints: map[string]interface{}{"string_format": "hostname"},
+			value:       "-api.example.com",
+			err:         fmt.Errorf("var:\n      value \"-api.example.com\" is not a valid hostname"),
+		},
+		{name: "IPv6", constraints: map[string]interface{}{"string_format": "ip"}, value: "::1"},
+		{
+			name:        "IP/Error",
+			constraints: map[string]interface{}{"string_format": "ip"},
+			value:       "256.0.0.1",
+			err:         fmt.Errorf("var:\n      value \"256.0.0.1\" is not a valid ip"),
+		},
+		{
+			name:        "NilValue",
+			constraints: map[string]interface{}{"string_format": "ip", "min": int64(1)},
+			value:       nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			link := &Link{KeyName: "var", Value: tc.value}
+			for k, v := range tc.constraints {
+				if err := link.parseConstraint(k, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var err error
+			if errs := validateLinks(map[string]*Link{"var": link}); errs != nil {
+				err = errs[0]
+			}
+			if diff := cmp.Diff(fmt.Sprint(tc.err), fmt.Sprint(err)); diff != "" {
+				t.Errorf("(-expected err +actual err)\n%s", diff)
+			}
+		})
+	}
+}
@@ -1,25 +1,76 @@
 package cogs
 
 import (
-	"net/http"
+	"context"
+	"fmt"
+	"time"
 
+	"go.mozilla.org/sops/v3/aes"
+	"go.mozilla.org/sops/v3/cmd/sops/common"
+	"go.mozilla.org/sops/v3/cmd/sops/formats"
 	"go.mozilla.org/sops/v3/decrypt"
+	"go.mozilla.org/sops/v3/keyservice"
 )
 
-func decryptFile(filePath string) ([]byte, error) {
-	encData, err := readFile(filePath)
+// decryptData decrypts SOPS encrypted data, returning early if ctx is done before decryption completes
+// since key services such as KMS can not be cancelled once a decryption is underway.
+// The keys of settings are used in place of ambient keys if settings is not nil
+func decryptData(ctx context.Context, encData []byte, format Format, settings *sopsSettings) ([]byte, error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		if settings == nil {
+			r.data, r.err = decrypt.Data(encData, string(format))
+		} else {
+			r.data, r.err = decryptWithKeys(encData, string(format), settings)
+		}
+		done <- r
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-done:
+		return r.data, r.err
+	}
+}
+
+// decryptWithKeys is decrypt.Data with the data key decrypted by a sopsKeyService
+func decryptWithKeys(encData []byte, format string, settings *sopsSettings) ([]byte, error) {
+	ks, err := newKeyService(settings)
+	if err != nil {
+		return nil, err
+	}
+	store := common.StoreForFormat(formats.FormatFromString(format))
+	tree, err := store.LoadEncryptedFile(encData)
+	if err != nil {
+		return nil, err
+	}
+	key, err := tree.Metadata.GetDataKeyWithKeyServices([]keyservice.KeyServiceClient{keyservice.NewCustomLocalClient(ks)})
 	if err != nil {
 		return nil, err
 	}
-	format := FormatForPath(filePath)
-	return decrypt.Data(encData, string(format))
-}
 
-func decryptHTTPFile(urlPath string, header http.Header, method, body string) ([]byte, error) {
-	encData, err := requestHTTPFile(urlPath, header, method, body)
+	cipher := aes.NewCipher()
+	mac, err := tree.Decrypt(key, cipher)
 	if err != nil {
 		return nil, err
 	}
-	format := FormatForPath(urlPath)
-	return decrypt.Data(encData, string(format))
+	// the MAC of the cleartext tree ensures that the document was not tampered with
+	originalMac, err := cipher.Decrypt(
+		tree.Metadata.MessageAuthenticationCode,
+		key,
+		tree.Metadata.LastModified.Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if originalMac != mac {
+		return nil, fmt.Errorf("failed to verify data integrity: expected mac %q, got %q", originalMac, mac)
+	}
+	return store.EmitPlainFile(tree.Branches)
 }
@@ -13,7 +13,14 @@ go build -o ./tmp_cogs ./cmd/cogs
 ./tmp_cogs gen ./examples/5.advanced.cog.toml complex_json
 ./tmp_cogs gen ./examples/5.advanced.cog.toml inheritor
 ./tmp_cogs gen ./examples/5.advanced.cog.toml external_inheritor
+./tmp_cogs gen ./examples/5.advanced.cog.toml constrained
+./tmp_cogs gen ./examples/5.advanced.cog.toml pinned
+./tmp_cogs gen ./examples/5.advanced.cog.toml fragments
+./tmp_cogs gen ./examples/5.advanced.cog.toml piped < ./test_files/json_map.json
 NEWLINE_VAR="
 This Var is on More than one line
 " NVIM=nvim ./tmp_cogs gen ./examples/6.envsubst.cog.toml envsubst -e
+./tmp_cogs gen ./examples/6.envsubst.cog.toml environment
+./tmp_cogs gen ./examples/8.interpolation.cog.toml interpolation
+./tmp_cogs gen ./examples/9.exec.cog.toml exec --allow-exec=git
 rm ./tmp_cogs
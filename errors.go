@@ -8,6 +8,13 @@ package cogs
 // Errors raised by package x.
 const (
 	ErrNoEncAndNoDecrypt = errConst("NoEnc and NoDecrypt cannot both be true")
+	ErrOfflineNoCache    = errConst("Offline requires a CacheDir")
+	ErrRecordAndReplay   = errConst("Record and Replay cannot both be set")
+	ErrOutsideRoot       = errConst("path is outside of the root directory")
+	ErrURLNotAllowed     = errConst("URL host is not allowed")
+	ErrCmdWithRoot       = errConst("cmd:// paths cannot be run when a root directory is set")
+	ErrGitWithRoot       = errConst("git:// paths cannot be read when a root directory is set")
+	ErrTLSTransport      = errConst("tls requires an HTTP client using an *http.Transport")
 )
 
 type errConst string
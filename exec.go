@@ -0,0 +1,78 @@
+package cogs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultExecTimeout limits the time a "cmd://" path can run if it does not define a timeout,
+// so that a command waiting on input such as a password prompt cannot block generation
+const DefaultExecTimeout = 30 * time.Second
+
+// execLoader runs the command of a "cmd://" Source and returns its stdout,
+// commands are run without a shell and must be present in the allowlist
+type execLoader struct {
+	allow   []string
+	timeout time.Duration // applied if the Source does not define a Timeout
+}
+
+// Load satisfies the Loader interface
+func (l *execLoader) Load(ctx context.Context, src *Source) (*Document, error) {
+	if len(src.Command) == 0 {
+		return nil, fmt.Errorf("%s: cmd must be defined", src.Path)
+	}
+	name := src.Command[0]
+	if !InList(name, l.allow) {
+		return nil, fmt.Errorf("command %q is not allowed, it must be added to --allow-exec", name)
+	}
+
+	if src.Timeout == 0 && l.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, src.Command[1:]...)
+	// relative commands are run from the directory of the cog file
+	cmd.Dir = src.Dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// surface a timeout or cancellation instead of the resulting "signal: killed"
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		argv := strings.Join(src.Command, " ")
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", argv, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", argv, err)
+	}
+	return &Document{Data: stdout.Bytes()}, nil
+}
+
+// parseCommand decodes an argv array: ["git", "rev-parse", "HEAD"]
+func parseCommand(v interface{}) ([]string, error) {
+	cmdErr := fmt.Errorf("must be a non-empty array of strings")
+	slice, ok := v.([]interface{})
+	if !ok || len(slice) == 0 {
+		return nil, cmdErr
+	}
+	var argv []string
+	for _, el := range slice {
+		arg, ok := el.(string)
+		if !ok {
+			return nil, cmdErr
+		}
+		argv = append(argv, arg)
+	}
+	if argv[0] == "" {
+		return nil, cmdErr
+	}
+	return argv, nil
+}
@@ -3,6 +3,7 @@ package cogs
 import (
 	"encoding/json"
 	"fmt"
+	"mime"
 	"strconv"
 	"strings"
 
@@ -120,8 +121,14 @@ func (t Format) Validate() error {
 	}
 }
 
-// FormatForPath returns the correct format given the path to a file
+// FormatForPath returns the correct format given the path to a file,
+// the query string and fragment of a URL are ignored: "https://host/file.json?raw=true"
 func FormatForPath(path string) Format {
+	if _, ok := urlScheme(path); ok {
+		if i := strings.IndexAny(path, "?#"); i >= 0 {
+			path = path[:i]
+		}
+	}
 	format := List
 	switch {
 	case IsYAMLFile(path):
@@ -153,6 +160,41 @@ func FormatLinkInput(link *Link) (format Format) {
 	return format
 }
 
+// formatForContentType returns the Format of a media type: "application/json; charset=utf-8" -> JSON,
+// an empty Format is returned for unknown media types
+func formatForContentType(contentType string) Format {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return JSON
+	case InList(mediaType, []string{"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml"}),
+		strings.HasSuffix(mediaType, "+yaml"):
+		return YAML
+	case InList(mediaType, []string{"application/toml", "text/toml", "text/x-toml"}):
+		return TOML
+	}
+	return ""
+}
+
+// formatForReadType returns the document Format implied by a ReadType,
+// used when the Format of a document cannot be inferred from its path
+func formatForReadType(rType ReadType) Format {
+	switch rType {
+	case rJSON, rJSONComplex:
+		return JSON
+	case rYAML, rYAMLComplex:
+		return YAML
+	case rTOML, rTOMLComplex:
+		return TOML
+	case rDotenv:
+		return Dotenv
+	}
+	return ""
+}
+
 // IsYAMLFile returns true if a given file path corresponds to a YAML file
 func IsYAMLFile(path string) bool {
 	return strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")
@@ -1,9 +1,12 @@
 package cogs
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
+	"sort"
+	"sync"
 
 	"github.com/pelletier/go-toml"
 	"github.com/pkg/errors"
@@ -24,6 +27,10 @@ type Gear struct {
 	outputType Format           // desired output type of the marshalled Gear
 	recursions uint             // the amount of recursions for the current Gear
 	filter     LinkFilter
+	gen        *Generator    // settings shared by every Gear of a Generate call
+	lockCtx    string        // context passed to Generate, sources of nested gears are locked under it
+	lockRoot   string        // cog file passed to Generate, locked paths are relative to it
+	sops       *sopsSettings // keys of the sops context key
 }
 
 func initGear(b []byte, envSubst bool) (*Gear, error) {
@@ -86,16 +93,53 @@ func (g *Gear) SetName(name string) {
 
 // ResolveMap outputs the flat associative string, resolving potential filepath pointers
 // held by Link objects by calling the .SetValue() method
-func (g *Gear) ResolveMap(ctx baseContext) (CfgMap, error) {
+func (g *Gear) ResolveMap(ctx context.Context, base baseContext) (CfgMap, error) {
 	var err error
 
-	if g.linkMap, err = parseCtx(ctx); err != nil {
+	if g.linkMap, err = g.gen.parseCtx(base); err != nil {
 		return nil, err
 	}
+	if base.Sops != nil {
+		if g.sops, err = parseSops(base.Sops); err != nil {
+			return nil, fmt.Errorf("sops: %w", err)
+		}
+	}
+	// body files are read upfront so that their references are followed by filters and order the groups
+	readBody := func(link *Link) error {
+		if err := link.body.readFile(g); err != nil {
+			return fmt.Errorf("%s: %w", link.KeyName, err)
+		}
+		return nil
+	}
+	// keys that are filtered out but referenced by the remaining keys are resolved without being output
+	var hidden map[string]*Link
 	if g.filter != nil {
-		if g.linkMap, err = g.filter(g.linkMap); err != nil {
+		all := make(map[string]*Link, len(g.linkMap))
+		for k, link := range g.linkMap {
+			all[k] = link
+		}
+		kept, err := g.filter(g.linkMap)
+		if err != nil {
+			return nil, err
+		}
+		if hidden, err = referencedLinks(all, kept, readBody); err != nil {
 			return nil, err
 		}
+		// the map returned by the filter is left untouched
+		g.linkMap = make(map[string]*Link, len(kept)+len(hidden))
+		for _, m := range []map[string]*Link{kept, hidden} {
+			for k, link := range m {
+				g.linkMap[k] = link
+			}
+		}
+	} else {
+		keys := Keys(g.linkMap)
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err = readBody(g.linkMap[k]); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// includes Link objects with a direct file and an empty SubPath:
@@ -105,130 +149,92 @@ func (g *Gear) ResolveMap(ctx baseContext) (CfgMap, error) {
 	// ex: var.path = ["./path", ".subpath"]
 	// ---
 
-	type PathGroup struct {
-		loadFile func(filePath string) ([]byte, error)
-		links    []*Link
-	}
-
-	pathGroups := make(map[distinctPath]*PathGroup)
+	pathGroups := make(map[distinctPath]*pathGroup)
+	var groups []*pathGroup
 
-	// 1. sort Links by Path
-	for _, link := range g.linkMap {
+	// 1. sort Links by Path, keys are visited in order so that groups are built deterministically
+	keys := Keys(g.linkMap)
+	sort.Strings(keys)
+	for _, k := range keys {
+		link := g.linkMap[k]
 		if link.Path == "" {
 			continue
 		}
 
 		if _, ok := pathGroups[link.distinctPath()]; !ok {
-			// read plaintext file into bytes
-			loadFile := readFile
-			switch {
-			case link.remote:
-				// must explicitly define variables
-				// or previous link values will bleed into loadFile func
-				header := link.header
-				method := link.method
-				body := link.body
-
-				if link.encrypted {
-					loadFile = func(path string) ([]byte, error) {
-						return decryptHTTPFile(path, header, method, body)
-					}
-				} else {
-					loadFile = func(path string) ([]byte, error) {
-						return requestHTTPFile(path, header, method, body)
-					}
-				}
-			case link.encrypted:
-				loadFile = decryptFile
+			method := link.method
+			if method == "" {
+				method = g.gen.DefaultMethod
 			}
-			pathGroups[link.distinctPath()] = &PathGroup{loadFile: loadFile, links: []*Link{}}
+			pathGroups[link.distinctPath()] = &pathGroup{
+				path: link.distinctPath(),
+				source: &Source{
+					Path:               g.getLinkFilePath(link.Path),
+					Header:             link.header,
+					Method:             method,
+					Command:            link.command,
+					Timeout:            link.timeout,
+					Retries:            link.retry.retries,
+					Backoff:            link.retry.backoff,
+					RetryNonIdempotent: link.retry.nonIdempotent,
+					Dir:                path.Dir(g.filePath),
+					Merge:              link.merge,
+					Format:             link.format,
+				},
+				encrypted: link.encrypted,
+				auth:      link.auth,
+				body:      link.body,
+				tls:       link.tls,
+				links:     []*Link{},
+			}
+			groups = append(groups, pathGroups[link.distinctPath()])
+		}
+		if pGroup := pathGroups[link.distinctPath()]; pGroup.format == "" {
+			pGroup.format = formatForReadType(link.readType)
 		}
 		pathGroups[link.distinctPath()].links = append(pathGroups[link.distinctPath()].links, link)
 	}
 
+	// groups holding the credentials or body references of another group are resolved in a later wave
+	waves, err := orderGroups(groups, g.linkMap)
+	if err != nil {
+		return nil, err
+	}
+
 	var errs error
-	for p, pGroup := range pathGroups {
-		var fileBuf []byte
-		var gearVar *Gear
-		// 2. for each distinct Path: generate a Reader object
-		linkFilePath := g.getLinkFilePath(p.path)
-		// if link.Path references the cog file, return the already read (and envsubst applied) value
-		if p.path == selfPath {
-			fileBuf = g.fileBuf
-		} else if fileBuf, err = pGroup.loadFile(linkFilePath); err != nil {
-			if os.IsNotExist(err) {
-				errs = multierr.Append(errs, err)
-				continue
-			}
+	for _, wave := range waves {
+		if err = ctx.Err(); err != nil {
 			return nil, err
 		}
-
-		newVisitorFn := NewYAMLVisitor
-		var visitor Visitor
-		// 3. create visitor to handle SubPath strings
-		// all read files should resolve to a yaml.Node, this includes JSON, TOML, and dotenv
-		switch FormatForPath(linkFilePath) {
-		case JSON:
-			newVisitorFn = NewJSONVisitor
-		case YAML:
-			newVisitorFn = NewYAMLVisitor
-		case TOML:
-			newVisitorFn = NewTOMLVisitor
-		case Dotenv:
-			newVisitorFn = NewDotenvVisitor
-		}
-
-		// 4. traverse every Path and possible SubPath retrieving the Link.Values associated with it
-		for _, link := range pGroup.links {
-			switch link.readType {
-			case rRaw: // no visitor is needed for a raw input
-				link.Value = string(fileBuf)
-			case rGear:
-				if g.recursions > uint(RecursionLimit) {
-					return nil, errors.New("recursion limit reached")
-				}
-				// assume that if path is selfPath then environmental substitution has
-				// already been applied
-				if gearVar == nil {
-					envSubst := EnvSubst && p.path != selfPath
-					gearVar, err = initGear(fileBuf, envSubst)
-					if err != nil {
-						return nil, errors.Wrap(err, link.KeyName)
-					}
-					gearVar.outputType = g.outputType
-					gearVar.filePath = g.getLinkFilePath(link.Path)
-					gearVar.recursions = g.recursions + 1
-					gearVar.recursions = g.recursions + 1
-				}
-				// always reapply filter since gear read types can specify separate
-				// key names
-				gearVar.filter = link.GearFilter
-				gearVar.Name = link.KeyName
-				// begin recursion
-				cfgMap, err := generate(link.SubPath, gearVar)
-				if err != nil {
-					return nil, errors.Wrap(err, link.KeyName)
+		// groups of a wave are resolved concurrently, results are collected in group order
+		// so that the aggregated errors are deterministic.
+		// The number of paths loaded at once is limited by Generator.Concurrency
+		missing := make([]error, len(wave))
+		waveCtx, cancel := context.WithCancel(ctx)
+		var fatalOnce sync.Once
+		var fatal error
+		var wg sync.WaitGroup
+		for i, pGroup := range wave {
+			wg.Add(1)
+			go func(i int, pGroup *pathGroup) {
+				defer wg.Done()
+				var err error
+				if missing[i], err = g.resolveGroup(waveCtx, pGroup); err != nil {
+					// the first fatal error cancels the remaining groups of the wave
+					fatalOnce.Do(func() {
+						fatal = err
+						cancel()
+					})
 				}
-				link.Value = cfgMap[link.SearchName]
-			default:
-				if visitor == nil {
-					visitor, err = newVisitorFn(fileBuf)
-					if err != nil {
-						return nil, err
-					}
-				}
-				if err := visitor.SetValue(link); err != nil {
-					return nil, errors.Wrap(err, link.KeyName)
-				}
-			}
-
+			}(i, pGroup)
 		}
-
-		// 5. add missing links to errs
-		if visitor != nil {
-			if visitorErrs := visitor.Errors(); visitorErrs != nil {
-				errs = multierr.Append(errs, multierr.Combine(visitorErrs...))
-			}
+		wg.Wait()
+		cancel()
+		if fatal != nil {
+			return nil, fatal
+		}
+		for i := range wave {
+			errs = multierr.Append(errs, missing[i])
 		}
 	}
 
@@ -237,9 +243,51 @@ func (g *Gear) ResolveMap(ctx baseContext) (CfgMap, error) {
 		return nil, fmt.Errorf("%+v", errs)
 	}
 
+	// 6. transform values read from a Link.Path
+	for _, link := range g.linkMap {
+		if link.Path != "" {
+			errs = multierr.Append(errs, applyTransforms(link))
+		}
+	}
+	if errs != nil {
+		return nil, fmt.Errorf("%+v", errs)
+	}
+
+	// 7. substitute %{key_name} references now that every Link.Value is resolved,
+	// literal values are transformed as soon as their own references are substituted
+	if err = interpolate(g.linkMap); err != nil {
+		return nil, fmt.Errorf("%+v", err)
+	}
+
+	// 8. check Link constraints against the final values
+	if constraintErrs := validateLinks(g.linkMap); constraintErrs != nil {
+		return nil, fmt.Errorf("%+v", multierr.Combine(constraintErrs...))
+	}
+
+	// 9. validate the context against a JSON Schema if <ctx>.schema is present
+	if base.Schema != "" {
+		values := make(CfgMap)
+		for key, link := range g.linkMap {
+			if !link.omitted() && hidden[key] == nil {
+				values[key] = link.Value
+			}
+		}
+		schemaPath, err := g.localPath(base.Schema)
+		if err != nil {
+			return nil, err
+		}
+		if err = ValidateSchema(schemaPath, values, g.linkMap); err != nil {
+			return nil, err
+		}
+	}
+
 	// final output
 	cfgOut := make(CfgMap)
 	for key, link := range g.linkMap {
+		// optional links that could not be found are left out
+		if link.omitted() || hidden[key] != nil {
+			continue
+		}
 		cfgOut[key], err = OutputCfg(link, g.outputType)
 		if err != nil {
 			return nil, err
@@ -250,11 +298,191 @@ func (g *Gear) ResolveMap(ctx baseContext) (CfgMap, error) {
 
 }
 
+// resolveGroup loads the Document of a path group and assigns the values of its Links,
+// missing holds the keys that could not be found while err aborts generation
+func (g *Gear) resolveGroup(ctx context.Context, pGroup *pathGroup) (missing error, err error) {
+	var doc *Document
+	var gearVar *Gear
+	p := pGroup.path
+	// credentials are added to a copy of the Source so that secrets never outlive the request
+	src := *pGroup.source
+	src.group = p
+	if err = g.authorize(&src, pGroup.auth); err != nil {
+		return fmt.Errorf("%s: %w", redactURL(src.Path), err), nil
+	}
+	if src.Body, src.ContentType, err = g.render(pGroup.body); err != nil {
+		return fmt.Errorf("%s: %w", redactURL(src.Path), err), nil
+	}
+	if src.TLS, err = g.tlsConfig(pGroup.tls); err != nil {
+		return nil, fmt.Errorf("%s: %w", redactURL(src.Path), err)
+	}
+	// 2. for each distinct Path: load the document with the Loader registered for its scheme
+	// if link.Path references the cog file, return the already read (and envsubst applied) value
+	if p.path == selfPath {
+		doc = &Document{Data: g.fileBuf, Format: FormatForPath(pGroup.source.Path)}
+	} else if doc, err = g.load(ctx, &src, pGroup.encrypted, pGroup.format); err != nil {
+		if os.IsNotExist(err) {
+			return err, nil
+		}
+		return nil, err
+	}
+	fileBuf := doc.Data
+
+	newVisitorFn := NewYAMLVisitor
+	var visitor Visitor
+	// 3. create visitor to handle SubPath strings
+	// all read files should resolve to a yaml.Node, this includes JSON, TOML, and dotenv
+	switch doc.Format {
+	case JSON:
+		newVisitorFn = NewJSONVisitor
+	case YAML:
+		newVisitorFn = NewYAMLVisitor
+	case TOML:
+		newVisitorFn = NewTOMLVisitor
+	case Dotenv:
+		newVisitorFn = NewDotenvVisitor
+	}
+
+	// 4. traverse every Path and possible SubPath retrieving the Link.Values associated with it
+	for _, link := range pGroup.links {
+		switch link.readType {
+		case rRaw: // no visitor is needed for a raw input
+			link.Value = string(fileBuf)
+		case rGear:
+			if g.recursions > uint(g.gen.RecursionLimit) {
+				return nil, errors.New("recursion limit reached")
+			}
+			// assume that if path is selfPath then environmental substitution has
+			// already been applied
+			if gearVar == nil {
+				envSubst := g.gen.EnvSubst && p.path != selfPath
+				gearVar, err = initGear(fileBuf, envSubst)
+				if err != nil {
+					return nil, errors.Wrap(err, link.KeyName)
+				}
+				gearVar.gen = g.gen
+				gearVar.lockCtx = g.lockCtx
+				gearVar.lockRoot = g.lockRoot
+				gearVar.outputType = g.outputType
+				gearVar.filePath = g.getLinkFilePath(link.Path)
+				gearVar.recursions = g.recursions + 1
+			}
+			// always reapply filter since gear read types can specify separate
+			// key names
+			gearVar.filter = link.GearFilter
+			gearVar.Name = link.KeyName
+			// begin recursion
+			cfgMap, err := generate(ctx, link.SubPath, gearVar)
+			if err != nil {
+				return nil, errors.Wrap(err, link.KeyName)
+			}
+			link.Value = cfgMap[link.SearchName]
+		default:
+			if visitor == nil {
+				visitor, err = newVisitorFn(fileBuf)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if err := visitor.SetValue(link); err != nil {
+				return nil, errors.Wrap(err, link.KeyName)
+			}
+		}
+		link.origins = doc.origins(link)
+
+	}
+
+	// 5. return missing links
+	if visitor != nil {
+		if goTemplateEscaped(visitor) {
+			g.gen.goTemplate.Store(true)
+		}
+		if visitorErrs := visitor.Errors(); visitorErrs != nil {
+			return multierr.Combine(visitorErrs...), nil
+		}
+	}
+	return nil, nil
+}
+
+// pathGroup holds the Links that share a distinct path and are resolved from a single Document
+type pathGroup struct {
+	path      distinctPath
+	source    *Source
+	encrypted bool
+	format    Format // fallback format implied by the first read type of the group that implies one
+	auth      *authConfig
+	body      requestBody // body before %{key_name} references are substituted
+	tls       *tlsSettings
+	links     []*Link
+}
+
+// orderGroups splits path groups into waves so that every group is resolved after the groups
+// holding the Links that its credentials and body reference, the order of groups within a wave is kept
+func orderGroups(groups []*pathGroup, linkMap map[string]*Link) ([][]*pathGroup, error) {
+	owners := make(map[*Link]*pathGroup)
+	for _, pGroup := range groups {
+		for _, link := range pGroup.links {
+			owners[link] = pGroup
+		}
+	}
+
+	state := make(map[*pathGroup]int)
+	levels := make(map[*pathGroup]int)
+	var visit func(pGroup *pathGroup) error
+	visit = func(pGroup *pathGroup) error {
+		switch state[pGroup] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("%s: request references a key that it resolves", redactURL(pGroup.path.path))
+		}
+		state[pGroup] = visiting
+		for _, name := range append(pGroup.auth.vars(), pGroup.body.refs()...) {
+			// unknown keys are reported when the request is made
+			if dep, ok := owners[linkMap[name]]; ok {
+				if err := visit(dep); err != nil {
+					return err
+				}
+				// a group is resolved in the wave following its latest dependency
+				if levels[dep]+1 > levels[pGroup] {
+					levels[pGroup] = levels[dep] + 1
+				}
+			}
+		}
+		state[pGroup] = visited
+		return nil
+	}
+
+	var waves [][]*pathGroup
+	for _, pGroup := range groups {
+		if err := visit(pGroup); err != nil {
+			return nil, err
+		}
+	}
+	for _, pGroup := range groups {
+		for len(waves) <= levels[pGroup] {
+			waves = append(waves, nil)
+		}
+		waves[levels[pGroup]] = append(waves[levels[pGroup]], pGroup)
+	}
+	return waves, nil
+}
+
 func (g *Gear) getLinkFilePath(linkPath string) string {
 	if linkPath == selfPath {
 		return g.filePath
 	}
-	if path.IsAbs(linkPath) || isValidURL(linkPath) {
+	if linkPath == stdinPath {
+		return "stdin://"
+	}
+	if isValidURL(linkPath) {
+		return linkPath
+	}
+	// "file://" paths are resolved like any other local path
+	if scheme, ok := urlScheme(linkPath); ok && scheme == "file" {
+		linkPath = linkPath[len("file://"):]
+	}
+	if path.IsAbs(linkPath) {
 		return linkPath
 	}
 	dir := path.Dir(g.filePath)
@@ -1,8 +1,11 @@
 package cogs
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/pelletier/go-toml"
@@ -10,24 +13,39 @@ import (
 )
 
 // NoEnc decides whether to handle encrypted variables
+//
+// Deprecated: only read by Generate, use Generator.NoEnc instead.
 var NoEnc bool = false
 
 // NoDecrypt decides whether to decrypt encrypted values, not compatible with NoEnc
+//
+// Deprecated: only read by Generate, use Generator.NoDecrypt instead.
 var NoDecrypt bool = false
 
 // EnvSubst decides whether to use environmental substitution or not
+//
+// Deprecated: only read by Generate, use Generator.EnvSubst instead.
 var EnvSubst bool = false
 
 // RecursionLimit is the limit used to define when to abort successive traversals of gears
+//
+// Deprecated: only read by Generate, use Generator.RecursionLimit instead.
 var RecursionLimit int = 12
 
 // distinctPath is used to separate k/v pairs that share the same URL path but
 // with differing bodies/headers/methods
 type distinctPath struct {
-	path   string
-	header string
-	method string
-	body   string
+	path    string
+	header  string
+	method  string
+	body    string
+	command string
+	timeout time.Duration
+	merge   MergeStrategy
+	format  Format
+	retry   retryPolicy
+	auth    string
+	tls     string
 }
 
 // Link holds all the data needed to resolve one string key value pair
@@ -36,15 +54,26 @@ type Link struct {
 	SearchName string      // same as keyName unless redefined using the `name` key: var.name="other_name"
 	Value      interface{} // Holds a complex or simple value for the given Link
 	// defaultValue interface{} // default value if key is missing
-	Path      string      // filepath string where Link can be resolved
-	SubPath   string      // object traversal string used to resolve Link if not at top level of document (yq syntax)
-	encrypted bool        // indicates if decryption is needed to resolve Link.Value
-	remote    bool        // indicates if an HTTP request is needed to return the given document
-	header    http.Header // HTTP request headers
-	method    string      // HTTP request method
-	body      string      // HTTP request body
-	aliases   []string    // additional key names that map to the same value
-	readType  ReadType
+	Path        string        // filepath string where Link can be resolved
+	SubPath     string        // object traversal string used to resolve Link if not at top level of document (yq syntax)
+	encrypted   bool          // indicates if decryption is needed to resolve Link.Value
+	remote      bool          // indicates if an HTTP request is needed to return the given document
+	header      http.Header   // HTTP request headers
+	method      string        // HTTP request method
+	body        requestBody   // HTTP request body
+	aliases     []string      // additional key names that map to the same value
+	transforms  []string      // names of transforms applied to the resolved value
+	constraints *constraints  // validation rules checked against the resolved value
+	optional    bool          // omit the key instead of returning an error if it cannot be found
+	command     []string      // argv of a "cmd://" path
+	timeout     time.Duration // time limit for loading the path, no limit if zero
+	merge       MergeStrategy // duplicate key handling for directory and glob paths
+	origins     []string      // files of a directory or glob path that the value was read from
+	format      Format        // explicit format of the document found at Path
+	retry       retryPolicy   // retries of failed HTTP requests
+	auth        *authConfig   // credentials of HTTP requests
+	tls         *tlsSettings  // TLS configuration of HTTP requests
+	readType    ReadType
 	// keys       []string    // key filter for Gear read types
 }
 
@@ -90,11 +119,23 @@ func (c Link) distinctPath() distinctPath {
 		header = fmt.Sprintf("%v", c.header)
 	}
 
+	command := ""
+	if c.command != nil {
+		command = fmt.Sprintf("%q", c.command)
+	}
+
 	return distinctPath{
-		path:   c.Path,
-		header: header,
-		method: c.method,
-		body:   c.body,
+		path:    c.Path,
+		header:  header,
+		method:  c.method,
+		body:    c.body.String(),
+		command: command,
+		timeout: c.timeout,
+		merge:   c.merge,
+		format:  c.format,
+		retry:   c.retry,
+		auth:    c.auth.String(),
+		tls:     c.tls.String(),
 	}
 }
 
@@ -110,22 +151,33 @@ func (c Link) String() string {
 }`, c.KeyName, c.SearchName, c.Value, c.Path, c.SubPath, c.encrypted)
 }
 
+// source returns the path and subpath a Link is resolved from: ["./path", ".subpath"]
+func (c Link) source() string {
+	if c.Path == "" {
+		return "cog file value"
+	}
+	subPath := "."
+	if c.SubPath != "" {
+		subPath = c.SubPath
+	}
+	if len(c.origins) > 0 {
+		return fmt.Sprintf("[%q, %q] (%s)", redactURL(c.Path), subPath, strings.Join(c.origins, ", "))
+	}
+	return fmt.Sprintf("[%q, %q]", redactURL(c.Path), subPath)
+}
+
+// omitted returns true if an optional Link could not be found
+func (c Link) omitted() bool {
+	return c.optional && c.Value == nil
+}
+
 // CfgMap is meant to represent a map with values of one or more unknown types
 type CfgMap map[string]interface{}
 
 // Join merges any number of CfgMap elements into a single CfgMap,
 // elements with a duplicate key name return an error.
 func Join(cfgs ...*CfgMap) (CfgMap, error) {
-	c := CfgMap{}
-	for _, cfg := range cfgs {
-		for k, v := range *cfg {
-			if _, ok := c[k]; ok {
-				return nil, fmt.Errorf("duplicate key found in two contexts: %q", k)
-			}
-			c[k] = v
-		}
-	}
-	return c, nil
+	return JoinWith(MergeError, cfgs...)
 }
 
 // LinkFilter if a function meant to filter a LinkMap
@@ -134,46 +186,44 @@ type LinkFilter func(map[string]*Link) (map[string]*Link, error)
 // Resolver is meant to define an object that returns the final string map to be used in a configuration
 // resolving any paths and sub paths defined in the underling config map
 type Resolver interface {
-	ResolveMap(baseContext) (CfgMap, error)
+	ResolveMap(context.Context, baseContext) (CfgMap, error)
 	SetName(string)
 	GetTree() *toml.Tree
 }
 
 // Generate is a top level command that takes an context name argument and cog file path to return a string map
+// using the package level settings, Generator.Generate should be used instead if settings can differ between calls
 func Generate(ctxName, cogPath string, outputType Format, filter LinkFilter) (CfgMap, error) {
-	var err error
+	return GenerateContext(context.Background(), ctxName, cogPath, outputType, filter)
+}
 
-	if err = outputType.Validate(); err != nil {
-		return nil, err
-	}
+// GenerateContext is Generate with a context.Context that is able to cancel or time-bound the resolution
+// of every path, including remote requests, decryption, and nested gears
+func GenerateContext(ctx context.Context, ctxName, cogPath string, outputType Format, filter LinkFilter) (CfgMap, error) {
+	gen := &Generator{
+		NoEnc:          NoEnc,
+		NoDecrypt:      NoDecrypt,
+		EnvSubst:       EnvSubst,
+		RecursionLimit: RecursionLimit,
+		DefaultMethod:  DefaultMethod,
+		OutputType:     outputType,
+		Filter:         filter,
+	}
+	cfgMap, err := gen.GenerateContext(ctx, ctxName, cogPath)
+	if gen.GoTemplateDelimPresent() {
+		GoTemplateDelimPresent = true
+	}
+	return cfgMap, err
+}
 
-	b, err := readFile(cogPath)
-	if err != nil {
-		return nil, err
-	}
+func generate(ctx context.Context, ctxName string, gear Resolver) (CfgMap, error) {
+	var err error
+	var base baseContext
 
-	gear, err := initGear(b, EnvSubst)
-	if err != nil {
+	if err = ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	gear.filePath = cogPath
-	gear.outputType = outputType
-	gear.recursions = 0
-	gear.filter = filter
-	cfgMap, err := generate(ctxName, gear)
-	if err != nil {
-		return nil, err
-	}
-
-	return cfgMap, nil
-
-}
-
-func generate(ctxName string, gear Resolver) (CfgMap, error) {
-	var err error
-	var ctx baseContext
-
 	table, ok := gear.GetTree().Get(ctxName).(*toml.Tree)
 	if !ok {
 		// TODO  ErrMissingContext = errorW{fmt:"%s: %s context missing from cog file"}
@@ -190,11 +240,11 @@ func generate(ctxName string, gear Resolver) (CfgMap, error) {
 		return nil, err
 	}
 
-	if err = mapstructure.Decode(tableMap, &ctx); err != nil {
+	if err = mapstructure.Decode(tableMap, &base); err != nil {
 		return nil, fmt.Errorf("generate context: %w", err)
 	}
-	ctx.Name = ctxName
-	genOut, err := gear.ResolveMap(ctx)
+	base.Name = ctxName
+	genOut, err := gear.ResolveMap(ctx, base)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", ctxName, err)
 	}
@@ -203,12 +253,12 @@ func generate(ctxName string, gear Resolver) (CfgMap, error) {
 }
 
 // parseCtx traverses an map interface to populate a gear's configMap
-func parseCtx(ctx baseContext) (linkMap map[string]*Link, err error) {
+func (gen *Generator) parseCtx(ctx baseContext) (linkMap map[string]*Link, err error) {
 	linkMap = make(map[string]*Link)
 
 	// skip fetching encrypted vars if flag is toggled
-	if !NoEnc && ctx.Enc.Vars != nil {
-		err = decodeEncVars(linkMap, ctx.Enc)
+	if !gen.NoEnc && ctx.Enc.Vars != nil {
+		err = decodeEncVars(linkMap, ctx.Enc, !gen.NoDecrypt)
 		if err != nil {
 			return nil, errors.Wrap(err, ctx.Name)
 		}
@@ -226,20 +276,39 @@ type baseContext struct {
 	Name string
 
 	// config maps
-	Vars CfgMap  `mapstructure:",omitempty"`
-	Enc  context `mapstructure:",omitempty"`
+	Vars CfgMap     `mapstructure:",omitempty"`
+	Enc  ctxSection `mapstructure:",omitempty"`
 	// inheritable
 	SearchName string      `mapstructure:"name,omitempty"`
 	Path       interface{} `mapstructure:",omitempty"`
 	ReadType   string      `mapstructure:"type,omitempty"`
 	Header     interface{} `mapstructure:",omitempty"`
 	Method     string      `mapstructure:",omitempty"`
-	Body       string      `mapstructure:",omitempty"`
+	Body       interface{} `mapstructure:",omitempty"`
+	Cmd        interface{} `mapstructure:",omitempty"`
+	Timeout    string      `mapstructure:",omitempty"`
+	Merge      string      `mapstructure:",omitempty"`
+	Format     string      `mapstructure:",omitempty"`
+	// HTTP request bodies
+	Form        interface{} `mapstructure:",omitempty"`
+	BodyFile    string      `mapstructure:"body_file,omitempty"`
+	ContentType string      `mapstructure:"content_type,omitempty"`
+	// HTTP retries
+	Retries            int    `mapstructure:",omitempty"`
+	Backoff            string `mapstructure:",omitempty"`
+	RetryNonIdempotent bool   `mapstructure:"retry_non_idempotent,omitempty"`
+	// HTTP credentials and TLS configuration
+	Auth interface{} `mapstructure:",omitempty"`
+	TLS  interface{} `mapstructure:"tls,omitempty"`
+	// validation
+	Schema string `mapstructure:",omitempty"` // JSON Schema file path the resolved context is validated against
+	// decryption
+	Sops interface{} `mapstructure:",omitempty"` // key files that decrypt the encrypted paths of the context
 }
 
 // toContext returns the unencrypted context properties ignoring baseContext.Enc
-func (b baseContext) toContext() context {
-	return context{
+func (b baseContext) toContext() ctxSection {
+	return ctxSection{
 		Name:       b.Name,
 		Path:       b.Path,
 		ReadType:   b.ReadType,
@@ -248,11 +317,26 @@ func (b baseContext) toContext() context {
 		Header:     b.Header,
 		Method:     b.Method,
 		Body:       b.Body,
+		Cmd:        b.Cmd,
+		Timeout:    b.Timeout,
+		Merge:      b.Merge,
+		Format:     b.Format,
+
+		Form:        b.Form,
+		BodyFile:    b.BodyFile,
+		ContentType: b.ContentType,
+
+		Retries:            b.Retries,
+		Backoff:            b.Backoff,
+		RetryNonIdempotent: b.RetryNonIdempotent,
+
+		Auth: b.Auth,
+		TLS:  b.TLS,
 	}
 }
 
-// context is a struct meant to represent both encrypted and plaintext sections of a baseContext
-type context struct {
+// ctxSection is a struct meant to represent both encrypted and plaintext sections of a baseContext
+type ctxSection struct {
 	Name       string
 	Path       interface{} `mapstructure:",omitempty"`
 	ReadType   string      `mapstructure:"type,omitempty"`
@@ -260,10 +344,25 @@ type context struct {
 	Vars       CfgMap      `mapstructure:",omitempty"`
 	Header     interface{} `mapstructure:",omitempty"`
 	Method     string      `mapstructure:",omitempty"`
-	Body       string      `mapstructure:",omitempty"`
+	Body       interface{} `mapstructure:",omitempty"`
+	Cmd        interface{} `mapstructure:",omitempty"`
+	Timeout    string      `mapstructure:",omitempty"`
+	Merge      string      `mapstructure:",omitempty"`
+	Format     string      `mapstructure:",omitempty"`
+	// HTTP request bodies
+	Form        interface{} `mapstructure:",omitempty"`
+	BodyFile    string      `mapstructure:"body_file,omitempty"`
+	ContentType string      `mapstructure:"content_type,omitempty"`
+	// HTTP retries
+	Retries            int    `mapstructure:",omitempty"`
+	Backoff            string `mapstructure:",omitempty"`
+	RetryNonIdempotent bool   `mapstructure:"retry_non_idempotent,omitempty"`
+	// HTTP credentials and TLS configuration
+	Auth interface{} `mapstructure:",omitempty"`
+	TLS  interface{} `mapstructure:"tls,omitempty"`
 }
 
-func decodeVars(linkMap map[string]*Link, ctx context) error {
+func decodeVars(linkMap map[string]*Link, ctx ctxSection) error {
 	var err error
 	var baseLink Link // any readType or Path declarations to be inherited by Links
 
@@ -292,7 +391,66 @@ func decodeVars(linkMap map[string]*Link, ctx context) error {
 	// HTTP method
 	baseLink.method = ctx.Method
 	// HTTP body
-	baseLink.body = ctx.Body
+	ctxBody := map[string]interface{}{"body": ctx.Body, "form": ctx.Form, "body_file": ctx.BodyFile, "content_type": ctx.ContentType}
+	for _, k := range []string{"body", "form", "body_file", "content_type"} {
+		if v := ctxBody[k]; v != nil && v != "" {
+			if err = baseLink.body.parseKey(k, v); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		}
+	}
+	if err = baseLink.body.validate(); err != nil {
+		return err
+	}
+	// command argv
+	if ctx.Cmd != nil {
+		if baseLink.command, err = parseCommand(ctx.Cmd); err != nil {
+			return fmt.Errorf("cmd: %w", err)
+		}
+	}
+	// load timeout
+	if ctx.Timeout != "" {
+		if baseLink.timeout, err = parseDuration(ctx.Timeout); err != nil {
+			return fmt.Errorf("timeout: %w", err)
+		}
+	}
+	// document format
+	if ctx.Format != "" {
+		baseLink.format = Format(ctx.Format)
+		if err = baseLink.format.Validate(); err != nil || baseLink.format == List {
+			return fmt.Errorf("format must be one of: json, yaml, toml, dotenv")
+		}
+	}
+	// HTTP retries
+	if ctx.Retries < 0 {
+		return fmt.Errorf("retries: must be a non-negative integer")
+	}
+	baseLink.retry.retries = ctx.Retries
+	if ctx.Backoff != "" {
+		if baseLink.retry.backoff, err = parseDuration(ctx.Backoff); err != nil {
+			return fmt.Errorf("backoff: %w", err)
+		}
+	}
+	baseLink.retry.nonIdempotent = ctx.RetryNonIdempotent
+	// HTTP credentials
+	if ctx.Auth != nil {
+		if baseLink.auth, err = parseAuth(ctx.Auth); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	// HTTP TLS configuration
+	if ctx.TLS != nil {
+		if baseLink.tls, err = parseTLS(ctx.TLS); err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+	}
+	// directory and glob merge strategy
+	if ctx.Merge != "" {
+		baseLink.merge = MergeStrategy(ctx.Merge)
+		if err = baseLink.merge.Validate(); err != nil {
+			return fmt.Errorf("merge: %w", err)
+		}
+	}
 	// -------------------
 
 	// check for duplicate keys for ctx.vars and ctx.enc.vars
@@ -325,13 +483,13 @@ func decodeVars(linkMap map[string]*Link, ctx context) error {
 }
 
 // decodeEncVars is a convenience function for passing ctx.enc variables to decodeEnv
-func decodeEncVars(linkMap map[string]*Link, ctx context) error {
+func decodeEncVars(linkMap map[string]*Link, ctx ctxSection, decrypt bool) error {
 	err := decodeVars(linkMap, ctx)
 	if err != nil {
 		return fmt.Errorf("decodeEncVars: %w", err)
 	}
 	// since ctx.enc should always be called first, mark all output Links as encrypted
-	if !NoDecrypt {
+	if decrypt {
 		for key, link := range linkMap {
 			link.encrypted = true
 			linkMap[key] = link
@@ -369,6 +527,10 @@ func parseLink(varName string, baseLink *Link, rawLink map[string]interface{}) (
 			if err := link.readType.Validate(); err != nil {
 				return nil, fmt.Errorf("%s.type: %w", varName, err)
 			}
+		case "optional":
+			if link.optional, ok = v.(bool); !ok {
+				return nil, fmt.Errorf("%s.optional must be a boolean", varName)
+			}
 		case "aliases":
 			aliasErr := fmt.Errorf("%s.aliases must be an array of strings", varName)
 			slice, ok := v.([]interface{})
@@ -382,6 +544,22 @@ func parseLink(varName string, baseLink *Link, rawLink map[string]interface{}) (
 				}
 				link.aliases = append(link.aliases, str)
 			}
+		case "transform":
+			transformErr := fmt.Errorf("%s.transform must be an array of strings", varName)
+			slice, ok := v.([]interface{})
+			if !ok {
+				return nil, transformErr
+			}
+			for i, v := range slice {
+				name, ok := v.(string)
+				if !ok {
+					return nil, transformErr
+				}
+				if _, err := getTransform(name); err != nil {
+					return nil, fmt.Errorf("%s.transform[%d]: %w", varName, i, err)
+				}
+				link.transforms = append(link.transforms, name)
+			}
 		case "header": // "net/http".Header is of type Header map[string][]string
 			if link.header, err = parseHeader(v); err != nil {
 				return nil, errors.Wrapf(err, "%s.header", varName)
@@ -392,12 +570,69 @@ func parseLink(varName string, baseLink *Link, rawLink map[string]interface{}) (
 				return nil, fmt.Errorf("%s.method must be a string", varName)
 			}
 			link.method = method
-		case "body":
-			link.body, ok = v.(string)
+		case "body", "form", "body_file", "content_type":
+			if err = link.body.parseKey(k, v); err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", varName, k, err)
+			}
+		case "cmd":
+			if link.command, err = parseCommand(v); err != nil {
+				return nil, fmt.Errorf("%s.cmd: %w", varName, err)
+			}
+		case "timeout":
+			if link.timeout, err = parseDuration(v); err != nil {
+				return nil, fmt.Errorf("%s.timeout: %w", varName, err)
+			}
+		case "format":
+			format, ok := v.(string)
+			// string formats are constraints on the value rather than the document format
+			if ok && InList(format, constraintFormats) {
+				if err = link.parseConstraint("string_format", format); err != nil {
+					return nil, fmt.Errorf("%s.format: %w", varName, err)
+				}
+				break
+			}
+			link.format = Format(format)
+			if err = link.format.Validate(); !ok || err != nil || link.format == List {
+				return nil, fmt.Errorf("%s.format must be one of: json, yaml, toml, dotenv, %s", varName, strings.Join(constraintFormats, ", "))
+			}
+		case "retries":
+			retries, ok := v.(int64)
+			if !ok || retries < 0 {
+				return nil, fmt.Errorf("%s.retries must be a non-negative integer", varName)
+			}
+			link.retry.retries = int(retries)
+		case "backoff":
+			if link.retry.backoff, err = parseDuration(v); err != nil {
+				return nil, fmt.Errorf("%s.backoff: %w", varName, err)
+			}
+		case "retry_non_idempotent":
+			if link.retry.nonIdempotent, ok = v.(bool); !ok {
+				return nil, fmt.Errorf("%s.retry_non_idempotent must be a boolean", varName)
+			}
+		case "auth":
+			if link.auth, err = parseAuth(v); err != nil {
+				return nil, fmt.Errorf("%s.auth: %w", varName, err)
+			}
+		case "tls":
+			if link.tls, err = parseTLS(v); err != nil {
+				return nil, fmt.Errorf("%s.tls: %w", varName, err)
+			}
+		case "merge":
+			strategy, ok := v.(string)
 			if !ok {
-				return nil, errors.Errorf("%s.body must be a string: %T", varName, v)
+				return nil, fmt.Errorf("%s.merge must be a string", varName)
+			}
+			link.merge = MergeStrategy(strategy)
+			if err = link.merge.Validate(); err != nil {
+				return nil, fmt.Errorf("%s.merge: %w", varName, err)
 			}
 		default:
+			if isConstraintKey(k) {
+				if err := link.parseConstraint(k, v); err != nil {
+					return nil, fmt.Errorf("%s.%s: %w", varName, k, err)
+				}
+				continue
+			}
 			return nil, fmt.Errorf("%s.%s is an unsupported key name", varName, k)
 		}
 
@@ -407,6 +642,9 @@ func parseLink(varName string, baseLink *Link, rawLink map[string]interface{}) (
 	if link.Path == "" && link.Value == nil {
 		return nil, fmt.Errorf("%s does not have a value assigned or %s.path defined", varName, varName)
 	}
+	if err = link.body.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", varName, err)
+	}
 
 	// if readType was not specified:
 	if _, ok := rawLink["type"]; !ok {
@@ -433,7 +671,37 @@ func parseLink(varName string, baseLink *Link, rawLink map[string]interface{}) (
 		}
 	}
 
-	link.remote = isValidURL(link.Path)
+	// HTTP properties are only inherited by and valid for HTTP paths
+	scheme := pathScheme(link.Path)
+	link.remote = scheme == "http" || scheme == "https"
+	// the argv of a command is only inherited by "cmd://" paths
+	if pathScheme(link.Path) == "cmd" {
+		if _, ok := rawLink["cmd"]; !ok && baseLink != nil {
+			link.command = baseLink.command
+		}
+	} else if _, ok := rawLink["cmd"]; ok {
+		return nil, fmt.Errorf("%s.cmd requires a path of \"cmd://\"", varName)
+	}
+	if _, ok := rawLink["timeout"]; !ok && baseLink != nil {
+		link.timeout = baseLink.timeout
+	}
+	if _, ok := rawLink["merge"]; !ok && baseLink != nil {
+		link.merge = baseLink.merge
+	}
+	if baseLink != nil {
+		if _, ok := rawLink["retries"]; !ok {
+			link.retry.retries = baseLink.retry.retries
+		}
+		if _, ok := rawLink["backoff"]; !ok {
+			link.retry.backoff = baseLink.retry.backoff
+		}
+		if _, ok := rawLink["retry_non_idempotent"]; !ok {
+			link.retry.nonIdempotent = baseLink.retry.nonIdempotent
+		}
+	}
+	if link.format == "" && baseLink != nil {
+		link.format = baseLink.format
+	}
 	// implicit header and method inheritance
 	// if path is a URL & baseLink is non-nil
 	if link.remote && baseLink != nil {
@@ -443,10 +711,20 @@ func parseLink(varName string, baseLink *Link, rawLink map[string]interface{}) (
 		if _, ok := rawLink["method"]; !ok {
 			link.method = baseLink.method
 		}
-		if _, ok := rawLink["body"]; !ok {
-			link.body = baseLink.body
+		link.body.inherit(baseLink.body, rawLink)
+		if _, ok := rawLink["auth"]; !ok {
+			link.auth = baseLink.auth
+		}
+		if _, ok := rawLink["tls"]; !ok {
+			link.tls = baseLink.tls
 		}
 	}
+	if link.auth != nil && !link.remote {
+		return nil, fmt.Errorf("%s.auth requires an HTTP path", varName)
+	}
+	if link.tls != nil && !link.remote {
+		return nil, fmt.Errorf("%s.tls requires an HTTP path", varName)
+	}
 
 	return &link, nil
 }
@@ -512,3 +790,19 @@ func decodePath(v interface{}, link *Link, baseLink *Link) error {
 	link.SubPath = decodedSlice[1]
 	return nil
 }
+
+// parseDuration decodes a positive duration string: "1m30s"
+func parseDuration(v interface{}) (time.Duration, error) {
+	str, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("must be a duration string")
+	}
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be a positive duration")
+	}
+	return d, nil
+}
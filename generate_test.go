@@ -1,10 +1,31 @@
 package cogs
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pelletier/go-toml"
@@ -82,7 +103,7 @@ func TestGenerate(t *testing.T) {
 			}
 			gear := &testGear{Name: tc.env, tree: tree}
 			cogName := tree.Get("name").(string)
-			config, err := generate(tc.env, gear)
+			config, err := generate(context.Background(), tc.env, gear)
 			// TODO implement (err cogError) Unwrap() error { return err.err } so that "%w" directive is used
 			if diff := cmp.Diff(fmt.Errorf("%s", tc.err), fmt.Errorf("%s", err), AllowUnexported); diff != "" {
 				t.Errorf("toml[%s], env[%s]: (-expected err +actual err)\n-%s", cogName, tc.env, diff)
@@ -95,6 +116,1725 @@ func TestGenerate(t *testing.T) {
 	}
 }
 
+func TestGenerateContext(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	cogPath := filepath.Join(t.TempDir(), "hung.cog.toml")
+	cogToml := fmt.Sprintf("name = \"hung\"\n[remote.vars]\nvar.path = %q\n", server.URL+"/hung.json")
+	if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := NewGenerator().GenerateContext(ctx, "remote", cogPath)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %q, got: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestGeneratorLoaders(t *testing.T) {
+	cogPath := filepath.Join(t.TempDir(), "loader.cog.toml")
+	cogToml := "name = \"loader\"\n[mem.vars]\nvar.path = \"mem://doc\"\nvar.name = \"key\"\n"
+	if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := NewGenerator()
+	gen.Loaders = map[string]Loader{
+		"mem": LoaderFunc(func(ctx context.Context, src *Source) (*Document, error) {
+			if src.Path != "mem://doc" {
+				return nil, fmt.Errorf("unexpected path: %s", src.Path)
+			}
+			return &Document{Data: []byte(`{"key": "mem_value"}`), Format: JSON}, nil
+		}),
+	}
+	config, err := gen.Generate("mem", cogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(CfgMap{"var": "mem_value"}, config); diff != "" {
+		t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+	}
+
+	gen.Loaders = nil
+	if _, err = gen.Generate("mem", cogPath); err == nil || !strings.Contains(err.Error(), `no loader registered for scheme "mem"`) {
+		t.Errorf("expected missing loader error, got: %v", err)
+	}
+}
+
+func TestGenerateFilterReferences(t *testing.T) {
+	gen := NewGenerator()
+	gen.Filter = func(linkMap map[string]*Link) (map[string]*Link, error) {
+		return map[string]*Link{"database_url": linkMap["database_url"]}, nil
+	}
+	config, err := gen.Generate("interpolation", "./examples/8.interpolation.cog.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keys referenced by database_url are resolved but left out of the output
+	want := CfgMap{"database_url": "postgres://admin@localhost:5432/db_var1_value"}
+	if diff := cmp.Diff(want, config); diff != "" {
+		t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateEnv(t *testing.T) {
+	t.Setenv("COGS_TEST_TOKEN", `tok"$en`)
+	t.Setenv("COGS_TEST_PORT", "007")
+
+	cogPath := filepath.Join(t.TempDir(), "env.cog.toml")
+	cogToml := `name = "env"
+[ci]
+path = "env://"
+[ci.vars]
+token = {path = [], name = "COGS_TEST_TOKEN"}
+port = {path = [], name = "COGS_TEST_PORT", type = "dotenv"}
+missing = {path = [], name = "COGS_TEST_MISSING", optional = true}
+defaulted = {path = [], name = "COGS_TEST_MISSING", optional = true, value = "default"}
+`
+	if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := NewGenerator().Generate("ci", cogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := CfgMap{"token": `tok"$en`, "port": "007", "defaulted": "default"}
+	if diff := cmp.Diff(expected, config); diff != "" {
+		t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateExec(t *testing.T) {
+	cogPath := filepath.Join(t.TempDir(), "exec.cog.toml")
+	cogToml := `name = "exec"
+[exec.vars]
+echo = {path = "cmd://", cmd = ["echo", "-n", "echo_value"], type = "raw"}
+json = {path = "cmd://", cmd = ["echo", '{"key": "json_value"}'], type = "json", name = "key"}
+`
+	if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := NewGenerator()
+	if _, err := gen.Generate("exec", cogPath); err == nil || !strings.Contains(err.Error(), `command "echo" is not allowed`) {
+		t.Errorf("expected allowlist error, got: %v", err)
+	}
+
+	gen.AllowExec = []string{"echo"}
+	config, err := gen.Generate("exec", cogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(CfgMap{"echo": "echo_value", "json": "json_value"}, config); diff != "" {
+		t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+	}
+
+	t.Run("DefaultTimeout", func(t *testing.T) {
+		// a command blocking without a timeout key is stopped by the default timeout of the loader
+		loader := &execLoader{allow: []string{"sleep"}, timeout: 50 * time.Millisecond}
+		start := time.Now()
+		_, err := loader.Load(context.Background(), &Source{Path: "cmd://", Command: []string{"sleep", "5"}})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected %v, got: %v", context.DeadlineExceeded, err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("expected the command to be stopped, took %s", elapsed)
+		}
+		// a timeout defined by the Source takes precedence
+		src := &Source{Path: "cmd://", Command: []string{"sleep", "0.2"}, Timeout: time.Second}
+		if _, err = loader.Load(context.Background(), src); err != nil {
+			t.Errorf("expected the Source timeout to be used, got: %v", err)
+		}
+	})
+}
+
+func TestGenerateGit(t *testing.T) {
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "infra-repo")
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=cogs", "-c", "user.email=cogs@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s: %s", args[0], err, out)
+		}
+	}
+	writeValues := func(version string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo, "values.yaml"), []byte("api:\n  version: "+version+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(repo, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "-q")
+	writeValues("v1.4.0")
+	git("add", "values.yaml")
+	git("commit", "-q", "-m", "v1.4.0")
+	git("tag", "v1.4.0")
+	git("checkout", "-q", "-b", "release/next")
+	writeValues("v1.5.0")
+	git("commit", "-q", "-am", "v1.5.0")
+	// the working tree should never be read
+	writeValues("dirty")
+
+	cogPath := filepath.Join(dir, "git.cog.toml")
+	cogToml := `name = "git"
+[release.vars]
+pinned = {path = ["git://infra-repo@v1.4.0/values.yaml", ".api"], name = "version"}
+next = {path = ["git://infra-repo@release/next/values.yaml", ".api"], name = "version"}
+`
+	if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := NewGenerator().Generate("release", cogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(CfgMap{"pinned": "v1.4.0", "next": "v1.5.0"}, config); diff != "" {
+		t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateFileSet(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"conf.d/10-base.yaml":  "api:\n  host: localhost\n  port: 8080\n",
+		"conf.d/20-api.json":   `{"api": {"port": 9090}}`,
+		"conf.d/30-worker.env": "REPLICAS=3\n",
+		"conf.d/README":        "skipped",
+		"conf[1].yaml":         "api:\n  host: literal\n  port: 1\n",
+	}
+	if err := os.Mkdir(filepath.Join(dir, "conf.d"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a directory holding only a symbolic link, as found in mounted ConfigMaps
+	if err := os.Mkdir(filepath.Join(dir, "linked.d"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "conf.d/10-base.yaml"), filepath.Join(dir, "linked.d/base.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		path     string
+		merge    string
+		varMerge string // raw TOML value of the merge key of a var
+		config   CfgMap
+		origins  map[string][]string
+		err      error
+	}{
+		{
+			name:    "Deep",
+			path:    "conf.d",
+			merge:   "deep",
+			config:  CfgMap{"host": "localhost", "port": 9090},
+			origins: map[string][]string{"host": {"conf.d/10-base.yaml"}, "port": {"conf.d/20-api.json"}},
+		},
+		{
+			name:  "Last",
+			path:  "conf.d/*",
+			merge: "last",
+			err:   errors.New(`["conf.d/*", ".api"]` + ":\n      unable to find key \"host\""),
+		},
+		{
+			name:    "First",
+			path:    "conf.d/*.json",
+			merge:   "first",
+			config:  CfgMap{"port": 9090},
+			origins: map[string][]string{"port": {"conf.d/20-api.json"}},
+		},
+		{
+			name:  "Error",
+			path:  "conf.d",
+			merge: "error",
+			err:   errors.New(`conf.d/20-api.json: duplicate key ".api" already found in conf.d/10-base.yaml`),
+		},
+		{
+			name: "NoMatch",
+			path: "conf.d/*.ini",
+			err:  fmt.Errorf("glob %s: %w", filepath.Join(dir, "conf.d/*.ini"), os.ErrNotExist),
+		},
+		{
+			name:    "SymlinkedFile",
+			path:    "linked.d",
+			config:  CfgMap{"host": "localhost", "port": 8080},
+			origins: map[string][]string{"host": {"linked.d/base.yaml"}, "port": {"linked.d/base.yaml"}},
+		},
+		{
+			// an existing file is not read as a glob pattern
+			name:    "LiteralGlobCharacters",
+			path:    "conf[1].yaml",
+			config:  CfgMap{"host": "literal", "port": 1},
+			origins: map[string][]string{"host": nil, "port": nil},
+		},
+		{
+			name:     "NonStringMerge",
+			path:     "conf.d",
+			varMerge: "1",
+			err:      errors.New("port: port.merge must be a string"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cogPath := filepath.Join(dir, "conf.cog.toml")
+			cogToml := fmt.Sprintf("name = \"conf\"\n[conf]\npath = [%q, \".api\"]\n", tc.path)
+			if tc.merge != "" {
+				cogToml += fmt.Sprintf("merge = %q\n", tc.merge)
+			}
+			cogToml += "[conf.vars]\n"
+			if tc.varMerge != "" {
+				cogToml += fmt.Sprintf("port = {path = [], merge = %s}\n", tc.varMerge)
+			} else {
+				cogToml += "port = {path = []}\n"
+			}
+			if tc.merge != "first" {
+				cogToml += "host = {path = []}\n"
+			}
+			if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			links := make(map[string]*Link)
+			gen := NewGenerator()
+			gen.Filter = func(linkMap map[string]*Link) (map[string]*Link, error) {
+				links = linkMap
+				return linkMap, nil
+			}
+			config, err := gen.Generate("conf", cogPath)
+			if tc.err != nil {
+				if err == nil || !strings.Contains(err.Error(), tc.err.Error()) {
+					t.Fatalf("expected error containing %q, got: %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.config, config); diff != "" {
+				t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+			}
+			origins := make(map[string][]string)
+			for k, link := range links {
+				origins[k] = link.origins
+			}
+			if diff := cmp.Diff(tc.origins, origins); diff != "" {
+				t.Errorf("Link.origins mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// countingReader counts the calls made to Read
+type countingReader struct {
+	r     io.Reader
+	reads int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.reads++
+	return c.r.Read(p)
+}
+
+func TestGenerateStdin(t *testing.T) {
+	cogPath := filepath.Join(t.TempDir(), "stdin.cog.toml")
+	cogToml := `name = "stdin"
+[first.vars]
+var = {path = ["-", ".first"], format = "toml"}
+[second.vars]
+var = {path = ["stdin://", ".second"], format = "toml"}
+url = {path = ["-", ".second"], format = "toml", pattern = "^https://"}
+`
+	if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdin := &countingReader{r: strings.NewReader("[first]\nvar = \"first_value\"\n[second]\nvar = \"second_value\"\nurl = \"https://example.com\"\n")}
+	gen := NewGenerator()
+	gen.Stdin = stdin
+	for _, ctxName := range []string{"first", "second"} {
+		if _, err := gen.Generate(ctxName, cogPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config, err := gen.Generate("second", cogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(CfgMap{"var": "second_value", "url": "https://example.com"}, config); diff != "" {
+		t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+	}
+	// io.ReadAll reads until io.EOF is returned, a second pass would require another set of reads
+	if reads := stdin.reads; reads > 2 {
+		t.Errorf("expected stdin to be read once, got %d reads", reads)
+	}
+}
+
+func TestGenerateFormat(t *testing.T) {
+	tomlBody := "[api]\nport = 8080\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/noext":
+			w.Header().Set("Content-Type", "application/toml; charset=utf-8")
+		case "/config.toml":
+			// the suffix of the URL path takes precedence over a mismatched Content-Type
+			w.Header().Set("Content-Type", "application/json")
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+		}
+		fmt.Fprint(w, tomlBody)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.conf"), []byte(tomlBody), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "users"), []byte(`{"admin": "admin@example.com"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cogPath := filepath.Join(dir, "format.cog.toml")
+	cogToml := fmt.Sprintf(`name = "format"
+[explicit]
+format = "toml"
+[explicit.vars]
+explicit = {path = ["app.conf", ".api"], name = "port"}
+[inferred.vars]
+content_type = {path = ["%[1]s/noext", ".api"], name = "port"}
+suffix = {path = ["%[1]s/config.toml", ".api"], name = "port"}
+query = {path = ["%[1]s/config.toml?raw=true", ".api"], name = "port"}
+[constrained.vars]
+admin = {path = "users", format = "json", string_format = "email"}
+contact = {value = "admin@example.com", format = "email"}
+[invalid.vars]
+contact = {value = "not an email", format = "email"}
+`, server.URL)
+	if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		ctx    string
+		config CfgMap
+		err    string
+	}{
+		{ctx: "explicit", config: CfgMap{"explicit": 8080}},
+		{ctx: "inferred", config: CfgMap{"content_type": 8080, "suffix": 8080, "query": 8080}},
+		// a document format and a string format constraint can be declared together
+		{ctx: "constrained", config: CfgMap{"admin": "admin@example.com", "contact": "admin@example.com"}},
+		// url, email, hostname, and ip formats constrain the value instead of the document
+		{ctx: "invalid", err: "is not a valid email"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.ctx, func(t *testing.T) {
+			config, err := NewGenerator().Generate(tc.ctx, cogPath)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(fmt.Sprintf("%+v", err), tc.err) {
+					t.Fatalf("expected error containing %q, got: %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.config, config); diff != "" {
+				t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGenerateRetries(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		hit := hits[r.URL.Path]
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/missing.json":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/down.json":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/slow.json" && hit == 1:
+			time.Sleep(200 * time.Millisecond)
+		case hit < 3 && r.URL.Path != "/slow.json":
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `{"var": "var_value"}`)
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name string
+		link string
+		hits int
+		err  []string
+	}{
+		{
+			name: "Get",
+			link: `{path = "%s/get.json", retries = 2}`,
+			hits: 3,
+		},
+		{
+			name: "PostNotRetried",
+			link: `{path = "%s/post.json", method = "POST", retries = 2}`,
+			hits: 1,
+			err:  []string{"POST returned status code of 502"},
+		},
+		{
+			name: "PostRetried",
+			link: `{path = "%s/post_retried.json", method = "POST", retries = 2, retry_non_idempotent = true}`,
+			hits: 3,
+		},
+		{
+			name: "AllAttemptsReported",
+			link: `{path = "%s/down.json", retries = 1}`,
+			hits: 2,
+			err:  []string{"attempt 1: ", "attempt 2: ", "GET returned status code of 503"},
+		},
+		{
+			name: "NotRetryable",
+			link: `{path = "%s/missing.json", retries = 2}`,
+			hits: 1,
+			err:  []string{"attempt 1: ", "GET returned status code of 404"},
+		},
+		{
+			name: "TimeoutPerAttempt",
+			link: `{path = "%s/slow.json", retries = 1, timeout = "50ms"}`,
+			hits: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cogPath := filepath.Join(t.TempDir(), "retry.cog.toml")
+			cogToml := "name = \"retry\"\n[retry]\nbackoff = \"1ms\"\n[retry.vars]\nvar = " + fmt.Sprintf(tc.link, server.URL) + "\n"
+			if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := NewGenerator().Generate("retry", cogPath)
+			for _, errMsg := range tc.err {
+				if err == nil || !strings.Contains(err.Error(), errMsg) {
+					t.Errorf("expected error containing %q, got: %v", errMsg, err)
+				}
+			}
+			if tc.err == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(CfgMap{"var": "var_value"}, config); diff != "" {
+					t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for p, hit := range hits {
+				if strings.Contains(tc.link, p) && hit != tc.hits {
+					t.Errorf("expected %d requests to %s, got %d", tc.hits, p, hit)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateAuth(t *testing.T) {
+	const secret = "s3cr3t"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login.json" {
+			fmt.Fprintf(w, `{"token": %q}`, secret)
+			return
+		}
+		user, password, ok := r.BasicAuth()
+		if r.Header.Get("Authorization") != "Bearer "+secret && !(ok && user == "admin" && password == secret) {
+			// echo the credentials back so that redaction of the response body is tested
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, `{"rejected": %q}`, r.Header.Get("Authorization"))
+			return
+		}
+		fmt.Fprint(w, `{"var": "var_value"}`)
+	}))
+	defer server.Close()
+	t.Setenv("COGS_TEST_TOKEN", secret)
+	t.Setenv("COGS_TEST_WRONG_TOKEN", "wr0ng_t0ken")
+
+	testCases := []struct {
+		name   string
+		vars   string
+		url    string
+		netrc  string
+		config CfgMap
+		err    []string
+		hidden []string
+	}{
+		{
+			name:   "BearerEnv",
+			vars:   `var = {path = "%s/var.json", auth = {type = "bearer", token_env = "COGS_TEST_TOKEN"}}`,
+			config: CfgMap{"var": "var_value"},
+		},
+		{
+			name: "BearerVar",
+			vars: `var = {path = "%s/var.json", auth = {type = "bearer", token_var = "token"}}
+token = {path = ["%[1]s/login.json", "."]}`,
+			config: CfgMap{"var": "var_value", "token": secret},
+		},
+		{
+			name:   "Basic",
+			vars:   `var = {path = "%s/var.json", auth = {type = "basic", user = "admin", password_env = "COGS_TEST_TOKEN"}}`,
+			config: CfgMap{"var": "var_value"},
+		},
+		{
+			name:   "Netrc",
+			vars:   `var = {path = "%s/var.json", auth = {type = "netrc", file = "netrc"}}`,
+			netrc:  "machine 127.0.0.1\nlogin admin\npassword " + secret + "\n",
+			config: CfgMap{"var": "var_value"},
+		},
+		{
+			name:   "NetrcDefault",
+			vars:   `var = {path = "%s/var.json", auth = {type = "netrc", file = "netrc"}}`,
+			netrc:  "machine example.com login other password other\ndefault login admin password " + secret + "\n",
+			config: CfgMap{"var": "var_value"},
+		},
+		{
+			name:   "Redacted/Error",
+			vars:   `var = {path = "%s/var.json", auth = {type = "bearer", token_env = "COGS_TEST_WRONG_TOKEN"}}`,
+			err:    []string{"status code of 401", redactedText},
+			hidden: []string{"wr0ng_t0ken"},
+		},
+		{
+			name:   "RedactedBasic/Error",
+			vars:   `var = {path = "%s/var.json", auth = {type = "basic", user = "admin", password_env = "COGS_TEST_WRONG_TOKEN"}}`,
+			err:    []string{"status code of 401"},
+			hidden: []string{"wr0ng_t0ken", base64.StdEncoding.EncodeToString([]byte("admin:wr0ng_t0ken"))},
+		},
+		{
+			name:   "RedactedURL/Error",
+			vars:   `var = {path = "%s/var.json"}`,
+			url:    strings.Replace(server.URL, "http://", "http://admin:hunter2@", 1),
+			err:    []string{"status code of 401", "admin:" + redactedText + "@"},
+			hidden: []string{"hunter2", base64.StdEncoding.EncodeToString([]byte("admin:hunter2"))},
+		},
+		{
+			name: "MissingEnv/Error",
+			vars: `var = {path = "%s/var.json", auth = {type = "bearer", token_env = "COGS_TEST_UNSET_TOKEN"}}`,
+			err:  []string{"environment variable COGS_TEST_UNSET_TOKEN is not set"},
+		},
+		{
+			name: "SelfReference/Error",
+			vars: `var = {path = "%s/var.json", auth = {type = "bearer", token_var = "var"}}`,
+			err:  []string{"request references a key that it resolves"},
+		},
+		{
+			name: "NotRemote/Error",
+			vars: `var = {path = "./var.json", auth = {type = "bearer", token_env = "COGS_TEST_TOKEN"}}`,
+			err:  []string{"var.auth requires an HTTP path"},
+		},
+		{
+			name: "InvalidType/Error",
+			vars: `var = {path = "%s/var.json", auth = {type = "digest"}}`,
+			err:  []string{"type must be one of: bearer, basic, netrc"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tc.netrc != "" {
+				if err := os.WriteFile(filepath.Join(dir, "netrc"), []byte(tc.netrc), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			vars := tc.vars
+			if strings.Contains(vars, "%") {
+				serverURL := server.URL
+				if tc.url != "" {
+					serverURL = tc.url
+				}
+				vars = fmt.Sprintf(vars, serverURL)
+			}
+			cogPath := filepath.Join(dir, "auth.cog.toml")
+			cogToml := "name = \"auth\"\n[auth.vars]\n" + vars + "\n"
+			if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := NewGenerator().Generate("auth", cogPath)
+			for _, errMsg := range tc.err {
+				if err == nil || !strings.Contains(err.Error(), errMsg) {
+					t.Errorf("expected error containing %q, got: %v", errMsg, err)
+				}
+			}
+			for _, hidden := range tc.hidden {
+				if err != nil && strings.Contains(err.Error(), hidden) {
+					t.Errorf("expected %q to be redacted from error: %v", hidden, err)
+				}
+			}
+			if tc.err != nil {
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.config, config); diff != "" {
+				t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGenerateTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/mtls.json" && len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"var": "var_value"}`)
+	}))
+
+	// a self-signed client certificate trusted by the server
+	dir := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "cogs"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	files := map[string][]byte{
+		"ca.pem":         pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}),
+		"client.pem":     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"client-key.pem": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+	for name, b := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		ctx    string
+		vars   string
+		client *http.Client
+		err    string
+	}{
+		{
+			name: "UnknownAuthority/Error",
+			vars: `var.path = "%s/var.json"`,
+			err:  "certificate signed by unknown authority",
+		},
+		{
+			name: "CA",
+			ctx:  `tls = {ca = "ca.pem"}`,
+			vars: `var.path = "%s/var.json"`,
+		},
+		{
+			name: "LinkCA",
+			vars: `var = {path = "%s/var.json", tls = {ca = "ca.pem"}}`,
+		},
+		{
+			name: "ServerName",
+			ctx:  `tls = {ca = "ca.pem", server_name = "example.com"}`,
+			vars: `var.path = "%s/var.json"`,
+		},
+		{
+			name: "ServerNameMismatch/Error",
+			ctx:  `tls = {ca = "ca.pem", server_name = "other.test"}`,
+			vars: `var.path = "%s/var.json"`,
+			err:  "certificate is valid for",
+		},
+		{
+			name: "MutualTLS",
+			ctx:  `tls = {ca = "ca.pem", cert = "client.pem", key = "client-key.pem"}`,
+			vars: `var.path = "%s/mtls.json"`,
+		},
+		{
+			name: "MutualTLSWithoutCert/Error",
+			ctx:  `tls = {ca = "ca.pem"}`,
+			vars: `var.path = "%s/mtls.json"`,
+			err:  "status code of 401",
+		},
+		{
+			name: "CertWithoutKey/Error",
+			ctx:  `tls = {ca = "ca.pem", cert = "client.pem"}`,
+			vars: `var.path = "%s/var.json"`,
+			err:  "tls: cert and key must be defined together",
+		},
+		{
+			name: "MissingCA/Error",
+			ctx:  `tls = {ca = "missing.pem"}`,
+			vars: `var.path = "%s/var.json"`,
+			err:  "tls.ca: ",
+		},
+		{
+			name: "NotRemote/Error",
+			vars: `var = {path = "./var.json", tls = {ca = "ca.pem"}}`,
+			err:  "var.tls requires an HTTP path",
+		},
+		{
+			// the TLS configuration of a wrapped transport cannot be replaced
+			name:   "CustomTransport/Error",
+			ctx:    `tls = {ca = "ca.pem"}`,
+			vars:   `var.path = "%s/var.json"`,
+			client: &http.Client{Transport: struct{ http.RoundTripper }{http.DefaultTransport}},
+			err:    "tls requires an HTTP client using an *http.Transport: struct { http.RoundTripper }",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vars := tc.vars
+			if strings.Contains(vars, "%") {
+				vars = fmt.Sprintf(vars, server.URL)
+			}
+			cogPath := filepath.Join(dir, "tls.cog.toml")
+			cogToml := "name = \"tls\"\n[tls]\n" + tc.ctx + "\n[tls.vars]\n" + vars + "\n"
+			if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			gen := NewGenerator()
+			gen.HTTPClient = tc.client
+			config, err := gen.Generate("tls", cogPath)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected error containing %q, got: %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(CfgMap{"var": "var_value"}, config); diff != "" {
+				t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGenerateBody(t *testing.T) {
+	var mu sync.Mutex
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		mu.Unlock()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"req": map[string]string{"body": string(body), "content_type": r.Header.Get("Content-Type")},
+		})
+	}))
+	defer server.Close()
+	t.Setenv("COGS_TEST_NAME", "cogs")
+
+	testCases := []struct {
+		name   string
+		ctx    string
+		keys   []string // keys kept by the filter of the Generator, every key is kept if nil
+		config CfgMap
+		err    string
+	}{
+		{
+			name:   "JSONString",
+			ctx:    `body = "{\"valid_json\": true}"`,
+			config: CfgMap{"body": "{\"valid_json\":true}\n", "content_type": ""},
+		},
+		{
+			name:   "Raw",
+			ctx:    `body = "plain text"` + "\n" + `content_type = "text/plain"`,
+			config: CfgMap{"body": "plain text", "content_type": "text/plain"},
+		},
+		{
+			name:   "Form",
+			ctx:    `form = {q = "%{name}", page = 2}`,
+			config: CfgMap{"body": "page=2&q=cogs", "content_type": "application/x-www-form-urlencoded"},
+		},
+		{
+			name:   "File",
+			ctx:    `body_file = "query.graphql"`,
+			config: CfgMap{"body": "{ repository(name: \"cogs\") { id } }\n", "content_type": "application/octet-stream"},
+		},
+		{
+			// the references of a body file are resolved even if the filter leaves them out
+			name:   "FileFiltered",
+			ctx:    `body_file = "query.graphql"`,
+			keys:   []string{"body"},
+			config: CfgMap{"body": "{ repository(name: \"cogs\") { id } }\n"},
+		},
+		{
+			name:   "FileContentType",
+			ctx:    `body_file = "query.graphql"` + "\n" + `content_type = "application/graphql"`,
+			config: CfgMap{"body": "{ repository(name: \"cogs\") { id } }\n", "content_type": "application/graphql"},
+		},
+		{
+			name: "Table",
+			ctx:  `body = {query = "query($id: Int!) { node(id: $id) }", variables = {id = "%{id}", name = "repo %{name}", escaped = "%%{name}"}}`,
+			config: CfgMap{
+				"body":         `{"query":"query($id: Int!) { node(id: $id) }","variables":{"escaped":"%{name}","id":42,"name":"repo cogs"}}`,
+				"content_type": "application/json",
+			},
+		},
+		{
+			name: "Conflict/Error",
+			ctx:  `body = "{}"` + "\n" + `form = {q = "cogs"}`,
+			err:  "only one of body, form, body_file can be defined",
+		},
+		{
+			name: "UnknownReference/Error",
+			ctx:  `body = {id = "%{missing}"}`,
+			err:  `unknown reference "missing"`,
+		},
+		{
+			name: "InvalidContentType/Error",
+			ctx:  `body = "text"` + "\n" + `content_type = "text/"`,
+			err:  "content_type: ",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "query.graphql"), []byte("{ repository(name: \"%{name}\") { id } }\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			cogPath := filepath.Join(dir, "body.cog.toml")
+			cogToml := fmt.Sprintf(`name = "body"
+[body]
+path = "%s/echo"
+method = "POST"
+%s
+[body.vars]
+body.path = [[], ".req"]
+content_type.path = [[], ".req"]
+id = 42
+name = {path = "env://", name = "COGS_TEST_NAME"}
+`, server.URL, tc.ctx)
+			if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			hits = 0
+			mu.Unlock()
+
+			gen := NewGenerator()
+			if tc.keys != nil {
+				gen.Filter = func(linkMap map[string]*Link) (map[string]*Link, error) {
+					kept := make(map[string]*Link)
+					for _, k := range tc.keys {
+						kept[k] = linkMap[k]
+					}
+					return kept, nil
+				}
+			}
+			config, err := gen.Generate("body", cogPath)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected error containing %q, got: %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			delete(config, "id")
+			delete(config, "name")
+			if diff := cmp.Diff(tc.config, config); diff != "" {
+				t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			// links sharing a body share a single request
+			if hits != 1 {
+				t.Errorf("expected 1 request, got %d", hits)
+			}
+		})
+	}
+}
+
+func TestGenerateConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		fmt.Fprint(w, `{"var": "var_value"}`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	var vars strings.Builder
+	want := CfgMap{}
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(&vars, "var%d = {path = [\"%s/%d.json\", \".\"], name = \"var\"}\n", i, server.URL, i)
+		want[fmt.Sprintf("var%d", i)] = "var_value"
+	}
+	cogPath := filepath.Join(dir, "concurrency.cog.toml")
+	if err := os.WriteFile(cogPath, []byte("name = \"concurrency\"\n[concurrency.vars]\n"+vars.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []int{1, 2, 4} {
+		t.Run(fmt.Sprint(concurrency), func(t *testing.T) {
+			mu.Lock()
+			maxInFlight = 0
+			mu.Unlock()
+			gen := NewGenerator()
+			gen.Concurrency = concurrency
+			config, err := gen.Generate("concurrency", cogPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, config); diff != "" {
+				t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if maxInFlight > concurrency {
+				t.Errorf("expected at most %d concurrent requests, got %d", concurrency, maxInFlight)
+			}
+			if concurrency > 1 && maxInFlight < 2 {
+				t.Errorf("expected paths to be loaded concurrently, got %d concurrent requests", maxInFlight)
+			}
+		})
+	}
+
+	t.Run("NestedGears", func(t *testing.T) {
+		// the limit is shared with the paths of nested gears
+		var rootVars strings.Builder
+		want := CfgMap{}
+		for i := 0; i < 3; i++ {
+			var nestedVars strings.Builder
+			for j := 0; j < 3; j++ {
+				key := fmt.Sprintf("n%d_%d", i, j)
+				fmt.Fprintf(&nestedVars, "%s = {path = [\"%s/%s.json\", \".\"], name = \"var\"}\n", key, server.URL, key)
+				fmt.Fprintf(&rootVars, "%s = {path = [\"./nested%d.cog.toml\", \"nested\"], type = \"gear\"}\n", key, i)
+				want[key] = "var_value"
+			}
+			nestedPath := filepath.Join(dir, fmt.Sprintf("nested%d.cog.toml", i))
+			if err := os.WriteFile(nestedPath, []byte("name = \"nested\"\n[nested.vars]\n"+nestedVars.String()), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rootPath := filepath.Join(dir, "root.cog.toml")
+		if err := os.WriteFile(rootPath, []byte("name = \"root\"\n[root.vars]\n"+rootVars.String()), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		mu.Lock()
+		maxInFlight = 0
+		mu.Unlock()
+		gen := NewGenerator()
+		gen.Concurrency = 2
+		config, err := gen.Generate("root", rootPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, config); diff != "" {
+			t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if maxInFlight > gen.Concurrency {
+			t.Errorf("expected at most %d concurrent requests, got %d", gen.Concurrency, maxInFlight)
+		}
+	})
+
+	t.Run("FatalErrorCancelsWave", func(t *testing.T) {
+		hang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/fatal.json" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		defer hang.Close()
+		fatalPath := filepath.Join(dir, "fatal.cog.toml")
+		fatalToml := fmt.Sprintf(`name = "fatal"
+[fatal.vars]
+hang = {path = "%[1]s/hang.json"}
+fatal = {path = "%[1]s/fatal.json"}
+`, hang.URL)
+		if err := os.WriteFile(fatalPath, []byte(fatalToml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		_, err := NewGenerator().Generate("fatal", fatalPath)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("expected the first fatal error to cancel the wave, took %s: %v", elapsed, err)
+		}
+		if !strings.Contains(err.Error(), "status code of 500") {
+			t.Errorf("expected the fatal error to be returned, got: %v", err)
+		}
+	})
+
+	t.Run("ErrorOrder", func(t *testing.T) {
+		errPath := filepath.Join(dir, "errors.cog.toml")
+		errToml := `name = "errors"
+[errors.vars]
+d = {path = "./d.json"}
+b = {path = "./b.json"}
+c = {path = "./c.json"}
+a = {path = "./a.json"}
+`
+		if err := os.WriteFile(errPath, []byte(errToml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		var first string
+		for i := 0; i < 10; i++ {
+			_, err := NewGenerator().Generate("errors", errPath)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if i == 0 {
+				first = err.Error()
+				// groups are reported in sorted key order
+				if !(strings.Index(first, "a.json") < strings.Index(first, "b.json") &&
+					strings.Index(first, "b.json") < strings.Index(first, "c.json") &&
+					strings.Index(first, "c.json") < strings.Index(first, "d.json")) {
+					t.Errorf("expected errors in sorted order, got: %s", first)
+				}
+			} else if err.Error() != first {
+				t.Errorf("expected a deterministic error, got:\n%s\nthen:\n%s", first, err)
+			}
+		}
+	})
+}
+
+func TestGenerateCache(t *testing.T) {
+	encrypted, err := os.ReadFile("./test_files/test.enc.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	requests, revalidated := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidated++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if r.URL.Path == "/test.enc.json" {
+			w.Write(encrypted)
+			return
+		}
+		fmt.Fprint(w, `{"var": "var_value"}`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	cogPath := filepath.Join(dir, "cache.cog.toml")
+	cogToml := fmt.Sprintf(`name = "cache"
+[cache.vars]
+var.path = "%[1]s/var.json"
+[cache.enc.vars]
+json_enc.path = "%[1]s/test.enc.json"
+`, server.URL)
+	if err = os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	want := CfgMap{"var": "var_value", "json_enc": "json_val"}
+
+	testCases := []struct {
+		name        string
+		ttl         time.Duration
+		offline     bool
+		requests    int
+		revalidated int
+	}{
+		{name: "Miss", requests: 2},
+		{name: "Revalidate", requests: 2, revalidated: 2},
+		{name: "Fresh", ttl: time.Hour},
+		{name: "Offline", offline: true},
+	}
+	// cases share a cache directory and run in order
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mu.Lock()
+			requests, revalidated = 0, 0
+			mu.Unlock()
+			gen := NewGenerator()
+			gen.CacheDir = cacheDir
+			gen.CacheTTL = tc.ttl
+			gen.Offline = tc.offline
+			config, err := gen.Generate("cache", cogPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, config); diff != "" {
+				t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if requests != tc.requests || revalidated != tc.revalidated {
+				t.Errorf("expected %d requests and %d revalidations, got %d and %d", tc.requests, tc.revalidated, requests, revalidated)
+			}
+		})
+	}
+
+	t.Run("Ciphertext", func(t *testing.T) {
+		entries, err := os.ReadDir(cacheDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Errorf("expected 2 cached entries, got %d", len(entries))
+		}
+		for _, entry := range entries {
+			b, err := os.ReadFile(filepath.Join(cacheDir, entry.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(b), "json_val") || strings.Contains(string(b), base64.StdEncoding.EncodeToString([]byte("json_val"))) {
+				t.Errorf("%s holds a decrypted value", entry.Name())
+			}
+		}
+	})
+
+	t.Run("OfflineMiss/Error", func(t *testing.T) {
+		gen := NewGenerator()
+		gen.CacheDir = t.TempDir()
+		gen.Offline = true
+		_, err := gen.Generate("cache", cogPath)
+		if err == nil || !strings.Contains(err.Error(), "response is not cached and offline mode is enabled") {
+			t.Errorf("expected an offline error, got: %v", err)
+		}
+	})
+
+	t.Run("OfflineNoCache/Error", func(t *testing.T) {
+		gen := NewGenerator()
+		gen.Offline = true
+		if _, err := gen.Generate("cache", cogPath); !errors.Is(err, ErrOfflineNoCache) {
+			t.Errorf("expected %v, got: %v", ErrOfflineNoCache, err)
+		}
+	})
+}
+
+func TestGenerateRecordReplay(t *testing.T) {
+	const secret, queryToken = "s3cr3t", "t0k3n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		// echo the credentials back so that redaction of recordings is tested
+		_, password, _ := r.BasicAuth()
+		json.NewEncoder(w).Encode(map[string]string{
+			"method":        r.Method,
+			"body":          string(body),
+			"authorization": r.Header.Get("Authorization"),
+			"password":      password,
+		})
+	}))
+	t.Setenv("COGS_TEST_TOKEN", secret)
+
+	dir := t.TempDir()
+	recordDir := filepath.Join(dir, "recordings")
+	writeCog := func(body string) string {
+		cogPath := filepath.Join(dir, "record.cog.toml")
+		cogToml := fmt.Sprintf(`name = "record"
+[record.vars]
+method = {path = "%[1]s/get.json", auth = {type = "bearer", token_env = "COGS_TEST_TOKEN"}}
+body = {path = "%[1]s/post.json", method = "POST", body = %[2]q}
+basic = {path = "%[1]s/basic.json?token=%[3]s", name = "method", auth = {type = "basic", user = "admin", password_env = "COGS_TEST_TOKEN"}}
+`, server.URL, body, queryToken)
+		if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return cogPath
+	}
+	cogPath := writeCog(`{"a": 1}`)
+	want := CfgMap{"method": "GET", "body": "{\"a\":1}\n", "basic": "GET"}
+
+	gen := NewGenerator()
+	gen.Record = recordDir
+	config, err := gen.Generate("record", cogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, config); diff != "" {
+		t.Errorf("record: Generator.Generate() mismatch (-want +got):\n%s", diff)
+	}
+	entries, err := os.ReadDir(recordDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected 3 recorded exchanges, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		b, err := os.ReadFile(filepath.Join(recordDir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var recorded exchange
+		if err = json.Unmarshal(b, &recorded); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(recorded.Body), secret) {
+			t.Errorf("%s holds a credential: %s", entry.Name(), recorded.Body)
+		}
+		if strings.Contains(recorded.URL, queryToken) {
+			t.Errorf("%s holds a query value: %s", entry.Name(), recorded.URL)
+		}
+	}
+
+	// requests are served from the recordings once the server is gone
+	server.Close()
+	gen = NewGenerator()
+	gen.Replay = recordDir
+	if config, err = gen.Generate("record", cogPath); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, config); diff != "" {
+		t.Errorf("replay: Generator.Generate() mismatch (-want +got):\n%s", diff)
+	}
+
+	_, err = gen.Generate("record", writeCog(`{"a": 2}`))
+	if err == nil || !strings.Contains(err.Error(), "replay: no recording of POST") {
+		t.Errorf("expected an unrecorded request error, got: %v", err)
+	}
+
+	gen.Record = recordDir
+	if _, err = gen.Generate("record", cogPath); !errors.Is(err, ErrRecordAndReplay) {
+		t.Errorf("expected %v, got: %v", ErrRecordAndReplay, err)
+	}
+}
+
+func TestGenerateLock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"remote": "value"}`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "local.yaml")
+	writeFile := func(content string) {
+		if err := os.WriteFile(filePath, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("local: value\n")
+	cogPath := filepath.Join(dir, "lock.cog.toml")
+	cogToml := fmt.Sprintf(`name = "lock"
+[lock.vars]
+local = {path = "./local.yaml"}
+remote = {path = "%s/remote.json"}
+[unlocked.vars]
+local = {path = "./local.yaml"}
+`, server.URL)
+	if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := NewGenerator()
+	if _, err := gen.Generate("lock", cogPath); err != nil {
+		t.Fatal(err)
+	}
+	lock := gen.Lockfile()
+	sources := Keys(lock.Contexts["lock"])
+	sort.Strings(sources)
+	if diff := cmp.Diff([]string{"GET " + server.URL + "/remote.json", "local.yaml"}, sources); diff != "" {
+		t.Errorf("Generator.Lockfile() mismatch (-want +got):\n%s", diff)
+	}
+	lockPath := LockfilePath(cogPath)
+	if err := lock.Write(lockPath); err != nil {
+		t.Fatal(err)
+	}
+	if lock, err := ReadLockfile(lockPath); err != nil {
+		t.Fatal(err)
+	} else {
+		gen = NewGenerator()
+		gen.Lock = lock
+	}
+	if _, err := gen.Generate("lock", cogPath); err != nil {
+		t.Errorf("locked: %v", err)
+	}
+
+	if _, err := gen.Generate("unlocked", cogPath); err == nil || !strings.Contains(err.Error(), "is not locked") {
+		t.Errorf("expected an unlocked source error, got: %v", err)
+	}
+	writeFile("local: changed\n")
+	if _, err := gen.Generate("lock", cogPath); err == nil || !strings.Contains(err.Error(), "content changed since it was locked") {
+		t.Errorf("expected a changed source error, got: %v", err)
+	}
+
+	t.Run("DistinctRequests", func(t *testing.T) {
+		// requests to a single URL that differ by header are locked separately
+		accept := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"var": %q}`, r.Header.Get("Accept"))
+		}))
+		defer accept.Close()
+		cogPath := filepath.Join(dir, "headers.cog.toml")
+		cogToml := fmt.Sprintf(`name = "headers"
+[headers.vars]
+a = {path = "%[1]s/var.json", name = "var", header = {accept = "a"}}
+b = {path = "%[1]s/var.json", name = "var", header = {accept = "b"}}
+`, accept.URL)
+		if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		gen := NewGenerator()
+		if _, err := gen.Generate("headers", cogPath); err != nil {
+			t.Fatal(err)
+		}
+		lock := gen.Lockfile()
+		if sources := lock.Contexts["headers"]; len(sources) != 2 {
+			t.Fatalf("expected 2 locked sources, got: %v", sources)
+		}
+		// groups are loaded concurrently, every load order must match the lockfile
+		for i := 0; i < 10; i++ {
+			gen := NewGenerator()
+			gen.Lock = lock
+			if _, err := gen.Generate("headers", cogPath); err != nil {
+				t.Fatalf("locked: %v", err)
+			}
+		}
+	})
+}
+
+func TestGenerateSandbox(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	for _, d := range []string{root, filepath.Join(root, "conf.d")} {
+		if err := os.Mkdir(d, 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"outside.yaml":          "var: outside\n",
+		"root/inside.yaml":      "var: inside\n",
+		"root/conf.d/base.yaml": "var: inside\n",
+		"root/nested.cog.toml": `name = "nested"
+[nested.vars]
+var.path = "../outside.yaml"
+`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{"root/link.yaml": "outside.yaml", "root/conf.d/link.yaml": "outside.yaml"} {
+		if err := os.Symlink(filepath.Join(dir, target), filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a .git file inside the root pointing to a repository outside of it
+	outsideRepo := filepath.Join(dir, "outside-repo")
+	if err := os.Mkdir(outsideRepo, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outsideRepo, "outside.yaml"), []byte("var: outside\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"init", "-q"}, {"add", "outside.yaml"}, {"commit", "-q", "-m", "outside"}} {
+		cmd := exec.Command("git", append([]string{"-C", outsideRepo, "-c", "user.name=cogs", "-c", "user.email=cogs@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s: %s", args[0], err, out)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sub", ".git"), []byte("gitdir: "+filepath.Join(outsideRepo, ".git")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	allowed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"var": "remote"}`)
+	}))
+	defer allowed.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, allowed.URL, http.StatusFound)
+	}))
+	defer redirect.Close()
+	allowedHost := strings.TrimPrefix(allowed.URL, "http://")
+
+	testCases := []struct {
+		name     string
+		path     string
+		allowURL []string
+		config   CfgMap
+		err      error
+	}{
+		{name: "Inside", path: "./inside.yaml", config: CfgMap{"var": "inside"}},
+		{name: "Parent", path: "../outside.yaml", err: ErrOutsideRoot},
+		{name: "Absolute", path: filepath.Join(dir, "outside.yaml"), err: ErrOutsideRoot},
+		{name: "Symlink", path: "./link.yaml", err: ErrOutsideRoot},
+		{name: "GlobSymlink", path: "./conf.d/*.yaml", err: ErrOutsideRoot},
+		{name: "NestedGear", path: "./nested.cog.toml", err: ErrOutsideRoot},
+		{name: "Command", path: "cmd://", err: ErrCmdWithRoot},
+		{name: "GitFile", path: "git://sub@HEAD/outside.yaml", err: ErrGitWithRoot},
+		{name: "AllowedURL", path: allowed.URL + "/var.json", allowURL: []string{allowedHost}, config: CfgMap{"var": "remote"}},
+		{name: "DisallowedURL", path: allowed.URL + "/var.json", allowURL: []string{"*.example.com"}, err: ErrURLNotAllowed},
+		{name: "DisallowedRedirect", path: redirect.URL + "/var.json", allowURL: []string{strings.TrimPrefix(redirect.URL, "http://")}, err: ErrURLNotAllowed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			link := fmt.Sprintf(`{path = %q}`, tc.path)
+			if tc.name == "NestedGear" {
+				link = fmt.Sprintf(`{path = [%q, "nested"], type = "gear", name = "var"}`, tc.path)
+			}
+			if tc.name == "Command" {
+				link = fmt.Sprintf(`{path = %q, cmd = ["cat", "../outside.yaml"], name = "var"}`, tc.path)
+			}
+			cogPath := filepath.Join(root, tc.name+".cog.toml")
+			cogToml := fmt.Sprintf("name = %q\n[sandbox.vars]\nvar = %s\n", tc.name, link)
+			if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			gen := NewGenerator()
+			gen.Root = root
+			gen.AllowURL = tc.allowURL
+			gen.AllowExec = []string{"cat"}
+			config, err := gen.Generate("sandbox", cogPath)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got: %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.config, config); diff != "" {
+				t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGenerateSops(t *testing.T) {
+	testFiles, err := filepath.Abs("test_files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ambient keys are unavailable so that only configured keys can decrypt
+	t.Setenv("GNUPGHOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("SOPS_AGE_KEY_FILE", filepath.Join(t.TempDir(), "keys.txt"))
+	ageKeyFile := filepath.Join(testFiles, "sops_functional_tests_age_key.txt")
+	pgpKeyring := filepath.Join(testFiles, "sops_functional_tests_key.asc")
+
+	testCases := []struct {
+		name       string
+		sops       string
+		path       string
+		ageKeyFile string
+		pgpKeyring string
+		config     CfgMap
+		err        string
+	}{
+		{
+			name:   "ContextAgeKeyFile",
+			sops:   `sops = {age_key_file = "../test_files/sops_functional_tests_age_key.txt"}`,
+			path:   "test.age.enc.yaml",
+			config: CfgMap{"age_var": "age_value"},
+		},
+		{
+			name:       "AgeKeyFile",
+			path:       "test.age.enc.yaml",
+			ageKeyFile: ageKeyFile,
+			config:     CfgMap{"age_var": "age_value"},
+		},
+		{
+			name:       "PGPKeyring",
+			path:       "test.enc.yaml",
+			pgpKeyring: pgpKeyring,
+			config:     CfgMap{"yaml_enc": "encrypted_value"},
+		},
+		{
+			// context keys take precedence over the Generator
+			name:       "WrongContextKeyring",
+			sops:       `sops = {pgp_keyring = "../test_files/test.age.enc.yaml"}`,
+			path:       "test.enc.yaml",
+			pgpKeyring: pgpKeyring,
+			err:        "pgp_keyring",
+		},
+		{
+			name: "AmbientKeys",
+			path: "test.age.enc.yaml",
+			err:  "Error getting data key",
+		},
+		{
+			name: "UnknownKey",
+			sops: `sops = {age_key = "./key.txt"}`,
+			path: "test.age.enc.yaml",
+			err:  "sops: 1 error(s) decoding",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var vars string
+			for k := range tc.config {
+				vars += fmt.Sprintf("%s.path = \"../test_files/%s\"\n", k, tc.path)
+			}
+			if vars == "" {
+				vars = fmt.Sprintf("var = {path = \"../test_files/%s\", name = \"age_var\"}\n", tc.path)
+			}
+			cogToml := fmt.Sprintf("name = %q\n[secret]\n%s\n[secret.enc.vars]\n%s", tc.name, tc.sops, vars)
+			// the cog file sits next to a link to test_files so that relative key files resolve
+			dir := t.TempDir()
+			if err := os.Mkdir(filepath.Join(dir, "examples"), 0o700); err != nil {
+				t.Fatal(err)
+			}
+			cogPath := filepath.Join(dir, "examples", "sops.cog.toml")
+			if err := os.Symlink(testFiles, filepath.Join(dir, "test_files")); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			gen := NewGenerator()
+			gen.AgeKeyFile = tc.ageKeyFile
+			gen.PGPKeyring = tc.pgpKeyring
+			config, err := gen.Generate("secret", cogPath)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected an error containing %q, got: %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.config, config); diff != "" {
+				t.Errorf("Generator.Generate() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJoinWith(t *testing.T) {
+	base := CfgMap{
+		"var":     "base_value",
+		"complex": map[string]interface{}{"a": "base_a", "nested": map[string]interface{}{"b": "base_b"}},
+	}
+	prod := CfgMap{
+		"var":     "prod_value",
+		"complex": map[string]interface{}{"nested": map[string]interface{}{"c": "prod_c"}},
+	}
+	testCases := []struct {
+		name     string
+		strategy MergeStrategy
+		config   CfgMap
+		err      error
+	}{
+		{
+			name:     "Error",
+			strategy: MergeError,
+			err:      errors.New("duplicate key found in two contexts"),
+		},
+		{
+			name:     "First",
+			strategy: MergeFirst,
+			config:   base,
+		},
+		{
+			name:     "Last",
+			strategy: MergeLast,
+			config:   prod,
+		},
+		{
+			name:     "Deep",
+			strategy: MergeDeep,
+			config: CfgMap{
+				"var": "prod_value",
+				"complex": map[string]interface{}{
+					"a":      "base_a",
+					"nested": map[string]interface{}{"b": "base_b", "c": "prod_c"},
+				},
+			},
+		},
+		{
+			name:     "Invalid/Error",
+			strategy: MergeStrategy("union"),
+			err:      errors.New("union is an invalid MergeStrategy"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := JoinWith(tc.strategy, &base, &prod)
+			if tc.err != nil {
+				// map iteration order decides which duplicate key is reported first
+				if err == nil || !strings.HasPrefix(err.Error(), tc.err.Error()) {
+					t.Errorf("expected err %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("JoinWith: %s", err)
+			}
+			if diff := cmp.Diff(tc.config, config); diff != "" {
+				t.Errorf("(-expected config +actual config):\n%s", diff)
+			}
+		})
+	}
+}
+
 var (
 	basicCogToml = `
 name = "basicCogToml"
@@ -149,10 +1889,10 @@ func (g *testGear) GetTree() *toml.Tree {
 }
 
 // ResolveMap is used to satisfy the Generator interface
-func (g *testGear) ResolveMap(ctx baseContext) (CfgMap, error) {
+func (g *testGear) ResolveMap(ctx context.Context, base baseContext) (CfgMap, error) {
 	var err error
 
-	g.linkMap, err = parseCtx(ctx)
+	g.linkMap, err = NewGenerator().parseCtx(base)
 	if err != nil {
 		return nil, err
 	}
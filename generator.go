@@ -0,0 +1,202 @@
+package cogs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultConcurrency is the number of paths of a context loaded at once if Generator.Concurrency is not set
+const DefaultConcurrency = 8
+
+// Generator holds the settings used to resolve the contexts of a cog manifest.
+// Generators do not share any mutable state, so separate Generators with differing
+// settings can be used concurrently
+type Generator struct {
+	NoEnc          bool         // skip fetching encrypted vars
+	NoDecrypt      bool         // skip decrypting encrypted vars, not compatible with NoEnc
+	EnvSubst       bool         // apply environmental substitution to cog manifests
+	RecursionLimit int          // limit used to abort successive traversals of gears
+	DefaultMethod  string       // HTTP method used when a Link does not define one
+	OutputType     Format       // desired output type of the generated CfgMap
+	Filter         LinkFilter   // filter applied to the link map of the requested context
+	HTTPClient     *http.Client // client used to request remote paths, http.DefaultClient is used if nil. The tls key requires a nil or *http.Transport
+	// Loaders keyed by URL scheme, these take precedence over loaders added through RegisterLoader
+	Loaders map[string]Loader
+	// AllowExec lists the commands that "cmd://" paths are allowed to run, no commands are run if empty.
+	// Commands are stopped after DefaultExecTimeout unless their Link or context defines a timeout
+	AllowExec []string
+	// Stdin is read by "-" and "stdin://" paths, os.Stdin is used if nil
+	Stdin io.Reader
+	// Concurrency limits the number of paths that are loaded at once, the limit is shared by
+	// every context and nested gear resolved by the Generator and is read when the first path is loaded.
+	// DefaultConcurrency is used if zero or negative
+	Concurrency int
+	// CacheDir stores the responses of HTTP GET requests, responses are not cached if empty.
+	// Encrypted documents are stored as they were received and are decrypted on every use
+	CacheDir string
+	// CacheTTL is the age under which a cached response is used without being revalidated,
+	// cached responses are always revalidated if zero
+	CacheTTL time.Duration
+	// Offline only uses cached responses, HTTP requests are never made
+	Offline bool
+	// Record writes every HTTP exchange to a directory. The credentials of auth, URL passwords, and Authorization
+	// headers are redacted from recordings, URL query values are left out of the recorded URL
+	Record string
+	// Replay serves the HTTP exchanges written by Record, unrecorded requests return an error
+	Replay string
+	// Lock fails generation if the content of a source differs from its locked hash
+	Lock *Lockfile
+	// Root restricts the local files read by a cog file and its nested gears to a directory,
+	// symbolic links are followed and "cmd://" and "git://" paths are rejected. Any local file can be read if empty
+	Root string
+	// AllowURL lists the host glob patterns that HTTP paths and their redirects can request, e.g. "*.example.com",
+	// a pattern holding a port only matches that port. Any URL can be requested if empty
+	AllowURL []string
+	// AgeKeyFile decrypts SOPS documents with the age identities of a file instead of SOPS_AGE_KEY_FILE
+	AgeKeyFile string
+	// PGPKeyring decrypts SOPS documents with the private keys of a keyring file instead of GNUPGHOME and gpg
+	PGPKeyring string
+
+	stdinOnce sync.Once
+	stdinBuf  []byte
+	stdinErr  error
+
+	loadOnce sync.Once
+	loadSem  chan struct{} // held while a path is loaded, see Generator.Concurrency
+
+	goTemplate atomic.Bool // set once a go template has been escaped into a string
+
+	lockMu sync.Mutex
+	locked map[string]map[string]string // source hashes keyed by context, see Generator.Lockfile
+}
+
+// NewGenerator returns a Generator with the default settings used by the cogs CLI
+func NewGenerator() *Generator {
+	return &Generator{
+		RecursionLimit: 12,
+		DefaultMethod:  http.MethodGet,
+		OutputType:     JSON,
+	}
+}
+
+// Validate ensures that the Generator settings are compatible with one another
+func (gen *Generator) Validate() error {
+	if gen.NoEnc && gen.NoDecrypt {
+		return ErrNoEncAndNoDecrypt
+	}
+	if gen.Offline && gen.CacheDir == "" {
+		return ErrOfflineNoCache
+	}
+	if gen.Record != "" && gen.Replay != "" {
+		return ErrRecordAndReplay
+	}
+	return gen.OutputType.Validate()
+}
+
+// Generate takes a context name and cog file path to return a string map
+func (gen *Generator) Generate(ctxName, cogPath string) (CfgMap, error) {
+	return gen.GenerateContext(context.Background(), ctxName, cogPath)
+}
+
+// GenerateContext is Generate with a context.Context that is able to cancel or time-bound the resolution
+// of every path, including remote requests, decryption, and nested gears
+func (gen *Generator) GenerateContext(ctx context.Context, ctxName, cogPath string) (CfgMap, error) {
+	if err := gen.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := gen.withinRoot(cogPath); err != nil {
+		return nil, err
+	}
+	b, err := readFile(cogPath)
+	if err != nil {
+		return nil, err
+	}
+
+	gear, err := initGear(b, gen.EnvSubst)
+	if err != nil {
+		return nil, err
+	}
+
+	gear.gen = gen
+	gear.filePath = cogPath
+	gear.outputType = gen.OutputType
+	gear.recursions = 0
+	gear.filter = gen.Filter
+	gear.lockCtx = ctxName
+	gear.lockRoot = cogPath
+	return generate(ctx, ctxName, gear)
+}
+
+// GoTemplateDelimPresent returns true if a go template has been escaped into a string
+// by any call to Generate, the escaped output can be restored with StripGoTemplateDelim
+func (gen *Generator) GoTemplateDelimPresent() bool {
+	return gen.goTemplate.Load()
+}
+
+// stdin reads Generator.Stdin a single time, every path referencing stdin shares the same document
+func (gen *Generator) stdin() ([]byte, error) {
+	gen.stdinOnce.Do(func() {
+		r := gen.Stdin
+		if r == nil {
+			r = os.Stdin
+		}
+		gen.stdinBuf, gen.stdinErr = io.ReadAll(r)
+	})
+	return gen.stdinBuf, gen.stdinErr
+}
+
+// concurrency returns the number of paths that can be loaded at once
+func (gen *Generator) concurrency() int {
+	if gen.Concurrency > 0 {
+		return gen.Concurrency
+	}
+	return DefaultConcurrency
+}
+
+// acquireLoad waits until a path can be loaded without exceeding Generator.Concurrency,
+// the returned function must be called once the path is loaded
+func (gen *Generator) acquireLoad(ctx context.Context) (release func(), err error) {
+	gen.loadOnce.Do(func() {
+		gen.loadSem = make(chan struct{}, gen.concurrency())
+	})
+	select {
+	case gen.loadSem <- struct{}{}:
+		return func() { <-gen.loadSem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// httpCache returns the cache of HTTP responses, nil if Generator.CacheDir is empty
+func (gen *Generator) httpCache() *httpCache {
+	if gen.CacheDir == "" {
+		return nil
+	}
+	return &httpCache{dir: gen.CacheDir, ttl: gen.CacheTTL, offline: gen.Offline}
+}
+
+// exchangeStore returns the store that HTTP exchanges are recorded to or replayed from,
+// nil if neither Generator.Record nor Generator.Replay are set
+func (gen *Generator) exchangeStore() *exchangeStore {
+	switch {
+	case gen.Replay != "":
+		return &exchangeStore{dir: gen.Replay, replay: true}
+	case gen.Record != "":
+		return &exchangeStore{dir: gen.Record}
+	}
+	return nil
+}
+
+// httpClient returns the client used to request remote paths
+func (gen *Generator) httpClient() *http.Client {
+	if gen.HTTPClient != nil {
+		return gen.HTTPClient
+	}
+	return http.DefaultClient
+}
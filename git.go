@@ -0,0 +1,84 @@
+package cogs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitLoader reads a file as it exists at a given revision of a local git repository:
+// "git://<repo>@<ref>/<file>", <repo> is relative to the cog file unless absolute
+type gitLoader struct{}
+
+// Load satisfies the Loader interface
+func (gitLoader) Load(ctx context.Context, src *Source) (*Document, error) {
+	repo, ref, file, err := parseGitPath(ctx, src.Path, src.Dir)
+	if err != nil {
+		return nil, err
+	}
+	b, err := gitCmd(ctx, repo, "cat-file", "blob", ref+":"+file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", src.Path, err)
+	}
+	return &Document{Data: b}, nil
+}
+
+// parseGitPath splits a "git://" path into its repository, ref, and file,
+// since refs can contain slashes every possible split is tried until a ref is found in the repository
+func parseGitPath(ctx context.Context, gitPath, dir string) (repo, ref, file string, err error) {
+	repo, rest, err := splitGitPath(gitPath, dir)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	parts := strings.Split(rest, "/")
+	if len(parts) < 2 || parts[0] == "" || strings.HasPrefix(parts[0], "-") {
+		return "", "", "", fmt.Errorf("%s: git path must be of the form git://<repo>@<ref>/<file>", gitPath)
+	}
+	for j := 1; j < len(parts); j++ {
+		ref = strings.Join(parts[:j], "/")
+		file = strings.Join(parts[j:], "/")
+		if _, err = gitCmd(ctx, repo, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err == nil {
+			return repo, ref, file, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", "", "", ctxErr
+		}
+	}
+	return "", "", "", fmt.Errorf("%s: unable to find a ref of %q in %s", gitPath, rest, repo)
+}
+
+// splitGitPath returns the repository of a "git://" path, relative to dir, and the "<ref>/<file>" that follows it
+func splitGitPath(gitPath, dir string) (repo, rest string, err error) {
+	rest = strings.TrimPrefix(gitPath, "git://")
+	i := strings.LastIndex(rest, "@")
+	if i < 1 {
+		return "", "", fmt.Errorf("%s: git path must be of the form git://<repo>@<ref>/<file>", gitPath)
+	}
+	repo = rest[:i]
+	if !filepath.IsAbs(repo) {
+		repo = filepath.Join(dir, repo)
+	}
+	return repo, rest[i+1:], nil
+}
+
+// gitCmd runs a git subcommand against a local repository and returns its stdout
+func gitCmd(ctx context.Context, repo string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repo}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,206 @@
+package cogs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
+)
+
+// isFileSet returns true if a local path is a glob pattern or a directory,
+// every file of a file set is merged into a single document
+func isFileSet(filePath string) bool {
+	// a file whose name holds glob characters is read as is
+	if info, err := os.Stat(filePath); err == nil {
+		return info.IsDir()
+	}
+	return strings.ContainsAny(filePath, "*?[")
+}
+
+// loadFileSet merges every file matched by a directory or glob Source into a single YAML document,
+// files are merged in sorted order using Source.Merge to resolve duplicate keys
+func loadFileSet(ctx context.Context, src *Source) (*Document, error) {
+	files, err := fileSet(src.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	strategy := src.Merge
+	if strategy == "" {
+		strategy = MergeError
+	}
+	merged := make(map[string]interface{})
+	origins := make(map[string][]string)
+	for _, file := range files {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		b, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		fileMap, err := decodeMap(b, FormatForPath(file))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		// record file names as they would be written in the cog file
+		origin := file
+		if rel, err := filepath.Rel(src.Dir, file); err == nil && !strings.HasPrefix(rel, "..") {
+			origin = rel
+		}
+		if err = mergeFile(strategy, merged, fileMap, "", origin, origins); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := yaml.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{Data: b, Format: YAML, Origins: origins}, nil
+}
+
+// fileSet returns the sorted files matched by a glob pattern or found in a directory,
+// symbolic links to files are followed and files without a known format suffix are skipped
+func fileSet(filePath string) ([]string, error) {
+	var matches []string
+	if info, err := os.Stat(filePath); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(filePath)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			matches = append(matches, filepath.Join(filePath, entry.Name()))
+		}
+	} else {
+		if matches, err = filepath.Glob(filePath); err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+	}
+	var files []string
+	for _, file := range matches {
+		// mounted ConfigMaps and Secrets hold symbolic links to their files
+		if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() && FormatForPath(file) != List {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return nil, &fs.PathError{Op: "glob", Path: filePath, Err: fs.ErrNotExist}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// decodeMap decodes a document of a given format into a map
+func decodeMap(b []byte, format Format) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	var err error
+	switch format {
+	case JSON:
+		err = json.Unmarshal(b, &m)
+	case TOML:
+		err = toml.Unmarshal(b, &m)
+	case Dotenv:
+		var envMap map[string]string
+		if envMap, err = godotenv.Unmarshal(string(b)); err == nil {
+			for k, v := range envMap {
+				m[k] = v
+			}
+		}
+	default:
+		err = yaml.Unmarshal(b, &m)
+	}
+	return m, err
+}
+
+// mergeFile merges the map of a single file into dst, origins records every file
+// that contributed to a given key path: ".api.port" -> ["conf.d/10-api.yaml"]
+func mergeFile(strategy MergeStrategy, dst, src map[string]interface{}, prefix, file string, origins map[string][]string) error {
+	keys := Keys(src)
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := src[k]
+		keyPath := prefix + "." + k
+		old, ok := dst[k]
+		if !ok {
+			dst[k] = v
+			recordOrigin(v, keyPath, file, origins)
+			continue
+		}
+
+		switch strategy {
+		case MergeFirst:
+			continue
+		case MergeDeep:
+			oldMap, oldOk := asMap(old)
+			srcMap, srcOk := asMap(v)
+			if !oldOk || !srcOk {
+				break
+			}
+			merged := make(map[string]interface{}, len(oldMap))
+			for mk, mv := range oldMap {
+				merged[mk] = mv
+			}
+			if !InList(file, origins[keyPath]) {
+				origins[keyPath] = append(origins[keyPath], file)
+			}
+			if err := mergeFile(strategy, merged, srcMap, keyPath, file, origins); err != nil {
+				return err
+			}
+			dst[k] = merged
+			continue
+		case MergeError:
+			return fmt.Errorf("%s: duplicate key %q already found in %s", file, keyPath, strings.Join(origins[keyPath], ", "))
+		}
+		// MergeLast, or MergeDeep with a non-map value: the value of the latest file replaces the old one
+		for p := range origins {
+			if p == keyPath || strings.HasPrefix(p, keyPath+".") {
+				delete(origins, p)
+			}
+		}
+		dst[k] = v
+		recordOrigin(v, keyPath, file, origins)
+	}
+	return nil
+}
+
+// recordOrigin assigns a file to a key path and every key path nested within it
+func recordOrigin(v interface{}, keyPath, file string, origins map[string][]string) {
+	origins[keyPath] = []string{file}
+	if m, ok := asMap(v); ok {
+		for k, el := range m {
+			recordOrigin(el, keyPath+"."+k, file, origins)
+		}
+	}
+}
+
+// origins returns the files of a merged Document that the value of a Link was read from,
+// the closest recorded parent key path is used if the exact key path was not recorded
+func (d *Document) origins(link *Link) []string {
+	if d.Origins == nil {
+		return nil
+	}
+	keyPath := strings.TrimSuffix(link.SubPath, ".")
+	if link.readType != rWhole && link.readType != rRaw {
+		keyPath += "." + link.SearchName
+	}
+	for keyPath != "" {
+		if files, ok := d.Origins[keyPath]; ok {
+			return files
+		}
+		i := strings.LastIndex(keyPath, ".")
+		if i < 0 {
+			break
+		}
+		keyPath = keyPath[:i]
+	}
+	return nil
+}
@@ -2,81 +2,334 @@ package cogs
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/textproto"
-	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
+	"go.uber.org/multierr"
 )
 
 // DefaultMethod uses GET for the default request type
+//
+// Deprecated: only read by Generate, use Generator.DefaultMethod instead.
 var DefaultMethod string = http.MethodGet
 
-// isValidURL tests a string to determine if it is a well-structured url or not.
+// isValidURL tests a string to determine if it is a "<scheme>://" prefixed URL that is not
+// a local "file://" path, any such URL is resolved by the Loader registered for its scheme
 func isValidURL(path string) bool {
-	if _, err := url.ParseRequestURI(path); err != nil {
-		return false
+	scheme, ok := urlScheme(path)
+	return ok && scheme != "file"
+}
+
+// defaultBackoff is the delay before the first retry if no backoff is defined
+const defaultBackoff = 500 * time.Millisecond
+
+// maxRetryWait is the longest delay between attempts that a Retry-After header
+// or the doubling of backoff can reach
+const maxRetryWait = time.Minute
+
+// retryPolicy holds the retry settings of a Link
+type retryPolicy struct {
+	retries       int
+	backoff       time.Duration
+	nonIdempotent bool
+}
+
+// retryableStatus lists the status codes of transient failures
+var retryableStatus = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooEarly,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// statusError is returned for responses without a 2xx status code
+type statusError struct {
+	url        string
+	method     string
+	code       int
+	body       []byte
+	retryAfter time.Duration // delay requested through the Retry-After header
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%q: %s returned status code of %d: %s", e.url, e.method, e.code, e.body)
+}
+
+// httpLoader requests remote files
+type httpLoader struct {
+	client    *http.Client
+	cache     *httpCache     // responses of GET requests are cached if non-nil
+	exchanges *exchangeStore // exchanges are recorded or replayed if non-nil
+}
+
+// Load satisfies the Loader interface, failed requests are retried using Source.Retries and Source.Backoff.
+// Source.Secrets and the password of the URL are redacted from returned errors
+func (l *httpLoader) Load(ctx context.Context, src *Source) (*Document, error) {
+	doc, err := l.loadCached(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	// conditional headers set through Source.Header can return a 304 without a cached entry
+	if doc == nil {
+		return nil, fmt.Errorf("%s: unexpected status code of %d", redactURL(src.Path), http.StatusNotModified)
+	}
+	// the suffix of a URL path takes precedence over the Content-Type of the response
+	if FormatForPath(src.Path) != List {
+		doc.Format = ""
+	}
+	return doc, nil
+}
+
+// loadCached returns the cached response of a Source, a fresh entry is used as is
+// while a stale entry is revalidated using its ETag and Last-Modified headers
+func (l *httpLoader) loadCached(ctx context.Context, src *Source) (*Document, error) {
+	if l.cache == nil {
+		doc, _, err := l.request(ctx, src, src.Header)
+		return doc, err
+	}
+	if !isCacheable(src) {
+		if l.cache.offline {
+			return nil, fmt.Errorf("%s: %s requests are never cached and offline mode is enabled", redactURL(src.Path), src.Method)
+		}
+		doc, _, err := l.request(ctx, src, src.Header)
+		return doc, err
 	}
 
-	if u, err := url.Parse(path); err != nil || u.Scheme == "" || u.Host == "" {
-		return false
+	key := cacheKey(src)
+	entry := l.cache.get(key)
+	switch {
+	case l.cache.offline && entry == nil:
+		return nil, fmt.Errorf("%s: response is not cached and offline mode is enabled", redactURL(src.Path))
+	case l.cache.offline, entry != nil && entry.fresh(l.cache.ttl):
+		return entry.document(), nil
 	}
 
-	return true
+	header := src.Header
+	if entry != nil {
+		header = entry.conditional(header)
+	}
+	doc, respHeader, err := l.request(ctx, src, header)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case doc == nil && entry == nil:
+		return nil, nil
+	case doc == nil: // 304 Not Modified
+		doc = entry.document()
+	default:
+		entry = &cacheEntry{
+			URL:          redactURL(src.Path),
+			ETag:         respHeader.Get("ETag"),
+			LastModified: respHeader.Get("Last-Modified"),
+			ContentType:  respHeader.Get("Content-Type"),
+			Data:         doc.Data,
+		}
+	}
+	entry.Stored = time.Now()
+	if err = l.cache.put(key, entry); err != nil {
+		return nil, err
+	}
+	return doc, nil
 }
 
-func requestHTTPFile(urlPath string, header http.Header, method, body string) ([]byte, error) {
-	var buf bytes.Buffer
+// request makes the HTTP request of a Source with the given header, retrying failed attempts.
+// A nil Document is returned for a 304 Not Modified response
+func (l *httpLoader) request(ctx context.Context, src *Source, header http.Header) (*Document, http.Header, error) {
+	attempts := 1
+	if src.Retries > 0 && (isIdempotent(src.Method) || src.RetryNonIdempotent) {
+		attempts += src.Retries
+	}
+	backoff := src.Backoff
+	if backoff == 0 {
+		backoff = defaultBackoff
+	}
 
-	if method == "" {
-		method = DefaultMethod
+	client := l.client
+	if src.TLS != nil {
+		var err error
+		if client, err = tlsClient(client, src.TLS); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", redactURL(src.Path), err)
+		}
+		defer client.CloseIdleConnections()
+	}
+	if l.exchanges != nil {
+		client = l.exchanges.client(client)
+		ctx = withExchangeSecrets(ctx, src)
 	}
 
+	var errs, lastErr error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			timer := time.NewTimer(retryWait(backoff, i, lastErr))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				errs = multierr.Append(errs, fmt.Errorf("attempt %d: %w", i+1, ctx.Err()))
+				return nil, nil, redact(fmt.Errorf("%s: %+v", redactURL(src.Path), errs), src)
+			case <-timer.C:
+			}
+		}
+
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if src.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, src.Timeout)
+		}
+		doc, respHeader, err := requestHTTPFile(attemptCtx, client, src.Path, header, src.Method, src.Body, src.ContentType)
+		cancel()
+		lastErr = err
+		if err == nil {
+			return doc, respHeader, nil
+		}
+		if attempts == 1 {
+			return nil, nil, redact(err, src)
+		}
+		errs = multierr.Append(errs, fmt.Errorf("attempt %d: %w", i+1, err))
+		if ctx.Err() != nil || !isRetryable(err) {
+			break
+		}
+	}
+	return nil, nil, redact(fmt.Errorf("%s: %+v", redactURL(src.Path), errs), src)
+}
+
+// isIdempotent returns true for HTTP methods that can be safely repeated
+func isIdempotent(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isRetryable returns true if a request failed because of a transient error:
+// a retryable status code, a timeout, or a refused or reset connection
+func isRetryable(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return InList(statusErr.code, retryableStatus)
+	}
+	if errors.Is(err, ErrURLNotAllowed) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// retryWait returns the delay before the given retry: backoff doubled after every retry,
+// or the Retry-After delay of the last error. Neither exceeds maxRetryWait
+// unless backoff itself is longer
+func retryWait(backoff time.Duration, retry int, lastErr error) time.Duration {
+	var statusErr *statusError
+	if errors.As(lastErr, &statusErr) && statusErr.retryAfter > 0 {
+		if statusErr.retryAfter > maxRetryWait {
+			return maxRetryWait
+		}
+		return statusErr.retryAfter
+	}
+	wait := backoff
+	// doubling stops at maxRetryWait so that the delay cannot overflow
+	for i := 1; i < retry && wait < maxRetryWait; i++ {
+		wait *= 2
+	}
+	if wait > maxRetryWait && wait > backoff {
+		return maxRetryWait
+	}
+	return wait
+}
+
+// parseRetryAfter decodes a Retry-After header holding either seconds or an HTTP date
+func parseRetryAfter(retryAfter string) time.Duration {
+	if retryAfter == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// requestHTTPFile returns the response body and header of a request,
+// the Format of the returned Document is inferred from the Content-Type of the response.
+// A body without a contentType must be JSON, a nil Document is returned for a 304 Not Modified response
+func requestHTTPFile(ctx context.Context, client *http.Client, urlPath string, header http.Header, method, body, contentType string) (*Document, http.Header, error) {
+	var buf bytes.Buffer
+
 	var i interface{}
 	payload := new(bytes.Buffer)
-	if body != "" {
+	if contentType != "" {
+		payload.WriteString(body)
+	} else if body != "" {
 		if err := json.Unmarshal([]byte(body), &i); err != nil {
-			return nil, errors.Wrap(err, "getHTTPFile")
+			return nil, nil, errors.Wrap(err, "getHTTPFile")
 		}
 
 		if err := json.NewEncoder(payload).Encode(i); err != nil {
-			return nil, errors.WithStack(err)
+			return nil, nil, errors.WithStack(err)
 		}
 	}
 
-	request, err := http.NewRequest(method, urlPath, payload)
+	request, err := http.NewRequestWithContext(ctx, method, urlPath, payload)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, nil, errors.WithStack(err)
 	}
 	for key, values := range header {
 		for _, value := range values {
 			request.Header.Add(key, value)
 		}
 	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
 
-	response, err := http.DefaultClient.Do(request)
+	response, err := client.Do(request)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, nil, errors.WithStack(err)
 	}
+	defer response.Body.Close()
 
 	// Copy data from the response to standard output
 	_, err = io.Copy(&buf, response.Body)
 
+	if response.StatusCode == http.StatusNotModified && (header.Get("If-None-Match") != "" || header.Get("If-Modified-Since") != "") {
+		return nil, response.Header, nil
+	}
 	if response.StatusCode < 200 || response.StatusCode >= 300 {
-		return nil, errors.Errorf("%q: %s returned status code of %d: %s", urlPath, method, response.StatusCode, buf.Bytes())
+		return nil, nil, &statusError{
+			url:        urlPath,
+			method:     method,
+			code:       response.StatusCode,
+			body:       buf.Bytes(),
+			retryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+		}
 	}
 
 	// handle io.Copy after status code check
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, nil, errors.WithStack(err)
 	}
 
-	defer response.Body.Close()
-
-	return buf.Bytes(), nil
+	return &Document{Data: buf.Bytes(), Format: formatForContentType(response.Header.Get("Content-Type"))}, response.Header, nil
 }
 
 func parseHeader(v interface{}) (http.Header, error) {
@@ -0,0 +1,100 @@
+package cogs
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestIsRetryable(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slow.Close()
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedURL := "http://" + listener.Addr().String()
+	listener.Close()
+
+	// get returns the error of a request made the same way as requestHTTPFile
+	get := func(ctx context.Context, client *http.Client, rawURL string) error {
+		_, _, err := requestHTTPFile(ctx, client, rawURL, nil, http.MethodGet, "", "")
+		if err == nil {
+			t.Fatalf("%s: expected an error", rawURL)
+		}
+		return err
+	}
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	notAllowed := (&Generator{AllowURL: []string{"example.com"}}).allowRedirects(&http.Client{})
+	redirect := httptest.NewServer(http.RedirectHandler(slow.URL, http.StatusFound))
+	defer redirect.Close()
+
+	testCases := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{name: "RetryableStatus", err: &statusError{code: http.StatusServiceUnavailable}, retryable: true},
+		{name: "Status", err: &statusError{code: http.StatusNotFound}},
+		{name: "Timeout", err: get(timeoutCtx, http.DefaultClient, slow.URL), retryable: true},
+		{name: "ConnectionRefused", err: get(context.Background(), http.DefaultClient, closedURL), retryable: true},
+		{name: "UnknownAuthority", err: get(context.Background(), http.DefaultClient, tlsServer.URL)},
+		{name: "UnsupportedScheme", err: get(context.Background(), http.DefaultClient, "ftp://example.com")},
+		{name: "URLNotAllowed", err: get(context.Background(), notAllowed, redirect.URL)},
+		{name: "Other", err: errors.New("unexpected")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if retryable := isRetryable(tc.err); retryable != tc.retryable {
+				t.Errorf("expected isRetryable %t for %q, got %t", tc.retryable, tc.err, retryable)
+			}
+		})
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	testCases := []struct {
+		name    string
+		backoff time.Duration
+		retry   int
+		lastErr error
+		wait    time.Duration
+	}{
+		{name: "First", backoff: time.Second, retry: 1, wait: time.Second},
+		{name: "Doubled", backoff: time.Second, retry: 3, wait: 4 * time.Second},
+		{name: "Capped", backoff: time.Second, retry: 100, wait: maxRetryWait},
+		{name: "LongBackoff", backoff: time.Hour, retry: 3, wait: time.Hour},
+		{
+			name:    "RetryAfter",
+			backoff: time.Second,
+			retry:   3,
+			lastErr: fmt.Errorf("attempt: %w", &statusError{retryAfter: 10 * time.Second}),
+			wait:    10 * time.Second,
+		},
+		{
+			name:    "RetryAfterCapped",
+			backoff: time.Second,
+			retry:   1,
+			lastErr: &statusError{retryAfter: 24 * time.Hour},
+			wait:    maxRetryWait,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if wait := retryWait(tc.backoff, tc.retry, tc.lastErr); wait != tc.wait {
+				t.Errorf("expected wait %s, got %s", tc.wait, wait)
+			}
+		})
+	}
+}
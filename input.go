@@ -6,6 +6,7 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/drone/envsubst"
 	"github.com/joho/godotenv"
@@ -20,6 +21,10 @@ import (
 // this helps avoid breaking generation when the cog file is moved or renamed
 const selfPath string = "."
 
+// initExpressionParser guards the package level expression parser of yqlib,
+// paths are visited concurrently
+var initExpressionParser sync.Once
+
 // readFile takes a filepath and returns the byte value of the data within
 func readFile(filePath string) ([]byte, error) {
 	file, err := os.Open(filePath)
@@ -145,6 +150,8 @@ func NewDotenvVisitor(buf []byte) (Visitor, error) {
 }
 
 func newVisitor(node *yaml.Node) Visitor {
+	// the evaluator initializes the expression parser of yqlib as well
+	initExpressionParser.Do(yqlib.InitExpressionParser)
 	return &visitor{
 		rootNode:       node,
 		visited:        make(map[string]map[string]interface{}),
@@ -160,6 +167,13 @@ type visitor struct {
 	visitedComplex map[string]interface{}
 	evaluator      yqlib.Evaluator
 	missing        map[string][]string // denotes links unable to be found
+	goTemplate     bool                // set once a go template has been escaped into a string
+}
+
+// goTemplateEscaped returns true if a Visitor escaped a go template into a string
+func goTemplateEscaped(v Visitor) bool {
+	vi, ok := v.(*visitor)
+	return ok && vi.goTemplate
 }
 
 func (vi *visitor) Errors() []error {
@@ -189,12 +203,10 @@ func (vi *visitor) getLink(link *Link, searchMap map[string]interface{}) (interf
 		return link.Value, true
 	}
 	// link is unable to be found in the searchMap at this point
-	subPath := "."
-	if link.SubPath != "" {
-		subPath = link.SubPath
+	if link.optional {
+		return nil, false
 	}
-
-	errKey := fmt.Sprintf("[%q, %q]", link.Path, subPath)
+	errKey := link.source()
 	errVal := fmt.Sprintf("unable to find key %q", link.SearchName)
 	if !InList(errVal, vi.missing[errKey]) {
 		vi.missing[errKey] = append(vi.missing[errKey], errVal)
@@ -250,7 +262,7 @@ func (vi *visitor) SetValue(link *Link) (err error) {
 	case deferred:
 		err = node.Decode(&cachedMap)
 		if err != nil {
-			NewGoTemplateToStr(node)
+			vi.goTemplate = newGoTemplateToStr(node) || vi.goTemplate
 			if err = node.Decode(&cachedMap); err != nil {
 				err = errors.Wrap(err, "node.Decode")
 			}
@@ -290,6 +302,9 @@ func (vi *visitor) visitComplex(link *Link) (err error) {
 		}
 
 		if link.Value, ok = vi.getLink(link, complexMap); !ok {
+			if link.optional {
+				return nil
+			}
 			return fmt.Errorf("unable to find %s", link.SearchName)
 		}
 
@@ -310,7 +325,9 @@ func (vi *visitor) visitComplex(link *Link) (err error) {
 		err = node.Decode(&i)
 	case rJSONComplex, rYAMLComplex, rTOMLComplex:
 		i = make(map[string]interface{})
-		err = visitComplex(i.(map[string]interface{}), node, link.readType)
+		var found bool
+		found, err = visitComplex(i.(map[string]interface{}), node, link.readType)
+		vi.goTemplate = found || vi.goTemplate
 	default:
 		err = fmt.Errorf("unsupported readType: %s", link.readType)
 	}
@@ -324,7 +341,7 @@ func (vi *visitor) visitComplex(link *Link) (err error) {
 }
 
 func (vi *visitor) get(subPath string) (*yaml.Node, error) {
-	yqlib.InitExpressionParser()
+	initExpressionParser.Do(yqlib.InitExpressionParser)
 	list, err := vi.evaluator.EvaluateNodes(subPath, vi.rootNode)
 	if err != nil {
 		return nil, errors.Wrap(err, "yqlib.EvaluateNodes")
@@ -347,6 +364,17 @@ func (vi *visitor) get(subPath string) (*yaml.Node, error) {
 func visitDotenv(cache map[string]interface{}, node *yaml.Node) (err error) {
 	var strEnv string
 
+	// a document that was already read as dotenv resolves to a flat map of strings
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.DocumentNode {
+		var envMap map[string]string
+		if err = node.Decode(&envMap); err == nil {
+			for k, v := range envMap {
+				cache[k] = v
+			}
+			return nil
+		}
+	}
+
 	if err = node.Decode(&strEnv); err != nil {
 		var sliceEnv []string
 		if err := node.Decode(&sliceEnv); err != nil {
@@ -386,25 +414,26 @@ func visitMap(cache map[string]interface{}, node *yaml.Node, rType ReadType) err
 	return unmarshal([]byte(strEnv), &cache)
 }
 
-func visitComplex(cache map[string]interface{}, node *yaml.Node, rType ReadType) error {
+// visitComplex returns true if a go template was escaped to decode the node
+func visitComplex(cache map[string]interface{}, node *yaml.Node, rType ReadType) (bool, error) {
 	if err := node.Decode(&cache); err == nil {
-		return nil
+		return false, nil
 	}
 
 	// handle potential goTemplate here
 	// TODO unify visitMap and visitComplex NewGoTemplateToStr calls
-	NewGoTemplateToStr(node)
+	found := newGoTemplateToStr(node)
 	if err := node.Decode(&cache); err == nil {
-		return nil
+		return found, nil
 	}
 
 	var strEnv string
 	if err := node.Decode(&strEnv); err != nil {
-		return fmt.Errorf("unable to decode node kind: %s to complex map format: %w", kindStr[node.Kind], err)
+		return found, fmt.Errorf("unable to decode node kind: %s to complex map format: %w", kindStr[node.Kind], err)
 	}
 	unmarshal, err := rType.getUnmarshal()
 	if err != nil {
-		return fmt.Errorf("visitComplex: %w", err)
+		return found, fmt.Errorf("visitComplex: %w", err)
 	}
-	return unmarshal([]byte(strEnv), &cache)
+	return found, unmarshal([]byte(strEnv), &cache)
 }
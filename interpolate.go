@@ -0,0 +1,151 @@
+package cogs
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.uber.org/multierr"
+)
+
+// interpolationRe matches %{key_name} references as well as the %%{ escape sequence,
+// the "%" prefix keeps references distinct from envsubst's "${}" syntax
+var interpolationRe = regexp.MustCompile(`%%\{|%\{([^{}]*)\}`)
+
+// interpolation states used for dependency ordering
+const (
+	unvisited = iota
+	visiting
+	visited
+)
+
+// interpolate replaces %{key_name} references held in the literal string values of a link map
+// with the resolved values of other keys in the same link map, a name that is not a key of the link map
+// returns an error. Literal "%{" text such as printf-style templates must be escaped as "%%{".
+// References are resolved in dependency order, so a referenced value may itself hold references.
+// Literal values are transformed once their references are substituted so that, like values read
+// from a Link.Path, a reference always holds the transformed value of the key it names
+func interpolate(linkMap map[string]*Link) error {
+	var errs, transformErrs error
+	state := make(map[string]int)
+
+	var resolve func(key string, chain []string) error
+	resolve = func(key string, chain []string) error {
+		link := linkMap[key]
+		if state[key] == visited {
+			return nil
+		}
+		state[key] = visiting
+		defer func() { state[key] = visited }()
+
+		if !isInterpolated(link) {
+			return nil
+		}
+		str, ok := link.Value.(string)
+		if !ok {
+			transformErrs = multierr.Append(transformErrs, applyTransforms(link))
+			return nil
+		}
+
+		chain = append(chain, key)
+		var err error
+		link.Value = interpolationRe.ReplaceAllStringFunc(str, func(match string) string {
+			if err != nil {
+				return match
+			}
+			if match == "%%{" {
+				return "%{"
+			}
+			ref := strings.TrimSpace(interpolationRe.FindStringSubmatch(match)[1])
+			refLink, ok := linkMap[ref]
+			if !ok {
+				err = fmt.Errorf("unknown reference %q", ref)
+				return match
+			}
+			if state[ref] == visiting {
+				err = fmt.Errorf("reference cycle: %s", strings.Join(append(chain, ref), " -> "))
+				return match
+			}
+			if err = resolve(ref, chain); err != nil {
+				err = fmt.Errorf("%s: %w", ref, err)
+				return match
+			}
+			var refStr string
+			if refStr, err = SimpleValueToString(refLink.Value); err != nil {
+				err = fmt.Errorf("reference %q: %w", ref, err)
+			}
+			return refStr
+		})
+		if err == nil {
+			transformErrs = multierr.Append(transformErrs, applyTransforms(link))
+		}
+		return err
+	}
+
+	keys := Keys(linkMap)
+	sort.Strings(keys)
+	for _, k := range keys {
+		if state[k] != unvisited {
+			continue
+		}
+		if err := resolve(k, nil); err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("%s: %w", k, err))
+		}
+	}
+	return multierr.Append(errs, transformErrs)
+}
+
+// referenceNames returns the key names of the %{key_name} references held in a string
+func referenceNames(s string) []string {
+	var names []string
+	for _, match := range interpolationRe.FindAllStringSubmatch(s, -1) {
+		if match[0] != "%%{" {
+			names = append(names, strings.TrimSpace(match[1]))
+		}
+	}
+	return names
+}
+
+// referencedLinks returns the Links of all that the Links of kept depend on without being part of kept:
+// the keys named by %{key_name} references in literal values, request bodies, and auth variables.
+// Dependencies are followed transitively so that filtered out keys can still be resolved,
+// readBody is called on every visited Link so that the references of body files are known
+func referencedLinks(all, kept map[string]*Link, readBody func(*Link) error) (map[string]*Link, error) {
+	deps := make(map[string]*Link)
+	var visit func(link *Link) error
+	visit = func(link *Link) error {
+		if err := readBody(link); err != nil {
+			return err
+		}
+		names := append(link.body.refs(), link.auth.vars()...)
+		if str, ok := link.Value.(string); ok && isInterpolated(link) {
+			names = append(names, referenceNames(str)...)
+		}
+		for _, name := range names {
+			dep, ok := all[name]
+			if !ok || kept[name] != nil || deps[name] != nil {
+				continue
+			}
+			deps[name] = dep
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	keys := Keys(kept)
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := visit(kept[k]); err != nil {
+			return nil, err
+		}
+	}
+	return deps, nil
+}
+
+// isInterpolated returns true if a Link holds a literal value defined in the cog file,
+// values read from a Link.Path are never interpolated
+func isInterpolated(link *Link) bool {
+	return link.Path == ""
+}
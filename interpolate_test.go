@@ -0,0 +1,133 @@
+package cogs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInterpolate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		linkMap map[string]*Link
+		values  map[string]interface{}
+		err     error
+	}{
+		{
+			name: "Basic",
+			linkMap: map[string]*Link{
+				"user":         {Value: "admin"},
+				"port":         {Value: int64(5432)},
+				"database_url": {Value: "postgres://%{user}@localhost:%{ port }/db"},
+			},
+			values: map[string]interface{}{
+				"user":         "admin",
+				"port":         int64(5432),
+				"database_url": "postgres://admin@localhost:5432/db",
+			},
+		},
+		{
+			name: "DependencyOrder",
+			linkMap: map[string]*Link{
+				"a": {Value: "%{b}/a"},
+				"b": {Value: "%{c}/b"},
+				"c": {Value: "c"},
+			},
+			values: map[string]interface{}{
+				"a": "c/b/a",
+				"b": "c/b",
+				"c": "c",
+			},
+		},
+		{
+			name: "PathValuesAreNotInterpolated",
+			linkMap: map[string]*Link{
+				"from_file": {Value: "%{other}", Path: "./file.yaml"},
+				"other":     {Value: "%%{escaped}"},
+			},
+			values: map[string]interface{}{
+				"from_file": "%{other}",
+				"other":     "%{escaped}",
+			},
+		},
+		{
+			name: "TransformedReference",
+			linkMap: map[string]*Link{
+				"encoded":   {KeyName: "encoded", Value: "aGVsbG8=", transforms: []string{"b64decode"}},
+				"greeting":  {KeyName: "greeting", Value: "%{encoded} world", transforms: []string{"upper"}},
+				"from_file": {KeyName: "from_file", Value: "hi", Path: "./file.yaml", transforms: []string{"upper"}},
+				"nested":    {KeyName: "nested", Value: "%{greeting}!"},
+			},
+			values: map[string]interface{}{
+				"encoded":   "hello",
+				"greeting":  "HELLO WORLD",
+				"from_file": "hi", // values read from a Link.Path are transformed before interpolation
+				"nested":    "HELLO WORLD!",
+			},
+		},
+		{
+			name: "TransformedNonString",
+			linkMap: map[string]*Link{
+				"port": {KeyName: "port", Value: int64(8080), transforms: []string{"b64encode"}},
+				"url":  {KeyName: "url", Value: "localhost:%{port}"},
+			},
+			values: map[string]interface{}{
+				"port": "ODA4MA==",
+				"url":  "localhost:ODA4MA==",
+			},
+		},
+		{
+			name: "UnknownReference/Error",
+			linkMap: map[string]*Link{
+				"a": {Value: "%{missing}"},
+			},
+			err: fmt.Errorf(`a: unknown reference "missing"`),
+		},
+		{
+			name: "EscapedLiteral",
+			linkMap: map[string]*Link{
+				"level": {Value: "info"},
+				"log":   {Value: "%%{time} [%{level}] %s"},
+			},
+			values: map[string]interface{}{
+				"level": "info",
+				"log":   "%{time} [info] %s",
+			},
+		},
+		{
+			name: "Cycle/Error",
+			linkMap: map[string]*Link{
+				"a": {Value: "%{b}"},
+				"b": {Value: "%{a}"},
+			},
+			err: fmt.Errorf("a: b: reference cycle: a -> b -> a"),
+		},
+		{
+			name: "ComplexReference/Error",
+			linkMap: map[string]*Link{
+				"a": {Value: "%{b}"},
+				"b": {Value: []interface{}{"b"}},
+			},
+			err: fmt.Errorf(`a: reference "b": [b] of type []interface {} is not a simple value`),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := interpolate(tc.linkMap)
+			if diff := cmp.Diff(fmt.Sprint(tc.err), fmt.Sprint(err)); diff != "" {
+				t.Errorf("(-expected err +actual err)\n%s", diff)
+			}
+			if tc.err != nil {
+				return
+			}
+			values := make(map[string]interface{})
+			for k, link := range tc.linkMap {
+				values[k] = link.Value
+			}
+			if diff := cmp.Diff(tc.values, values); diff != "" {
+				t.Errorf("(-expected values +actual values)\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package cogs
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source describes the document that a Link.Path points to
+type Source struct {
+	Path   string      // file path or URL of the document, relative file paths are already resolved against the cog file
+	Header http.Header // HTTP request headers
+	Method string      // HTTP request method
+	Body   string      // HTTP request body
+	// ContentType is the Content-Type of Body, a Body without a ContentType is sent as JSON
+	ContentType string
+	// Command is the argv of a "cmd://" path
+	Command []string
+	// Timeout limits the time spent loading the Source, no limit is applied if zero
+	// except for "cmd://" sources which default to DefaultExecTimeout.
+	// Remote sources apply the Timeout to each attempt
+	Timeout time.Duration
+	// Retries is the number of times a failed HTTP request is retried
+	Retries int
+	// Backoff is the delay before the first retry, doubling on every following retry
+	Backoff time.Duration
+	// RetryNonIdempotent allows requests that are not idempotent, such as POST, to be retried
+	RetryNonIdempotent bool
+	// Dir is the directory of the cog file that references the Source
+	Dir string
+	// Merge resolves duplicate keys across the files of a directory or glob path
+	Merge MergeStrategy
+	// Format is the explicit format of the document, it takes precedence over the Format of the loaded Document
+	Format Format
+	// Secrets holds the credentials added to Header, Loaders must redact them from returned errors
+	Secrets []string
+	// TLS configures the client of HTTP requests, the client of the Generator is used as is if nil
+	TLS *tls.Config
+
+	group distinctPath // Link properties of the path group that loads the Source, see Gear.lockKey
+}
+
+// Document holds the unparsed contents returned by a Loader
+type Document struct {
+	Data   []byte
+	Format Format // format of Data, an empty Format defers to the suffix of Source.Path
+	// Origins records the files that each key path of a merged directory or glob document was read from
+	Origins map[string][]string
+}
+
+// stdinPath is a reserved filepath string that reads the document piped into cogs,
+// it is equivalent to "stdin://"
+const stdinPath string = "-"
+
+// Loader retrieves the Document found at a given Source
+type Loader interface {
+	Load(ctx context.Context, src *Source) (*Document, error)
+}
+
+// LoaderFunc allows an ordinary function to be used as a Loader
+type LoaderFunc func(ctx context.Context, src *Source) (*Document, error)
+
+// Load calls fn(ctx, src)
+func (fn LoaderFunc) Load(ctx context.Context, src *Source) (*Document, error) {
+	return fn(ctx, src)
+}
+
+var (
+	loadersMu sync.RWMutex
+	loaders   = make(map[string]Loader)
+)
+
+// RegisterLoader makes a Loader available for paths prefixed with "<scheme>://",
+// a registered Loader takes precedence over the built-in file, env, cmd, git, stdin, http, and https loaders.
+// Registering a scheme that is already in use returns an error
+func RegisterLoader(scheme string, loader Loader) error {
+	loadersMu.Lock()
+	defer loadersMu.Unlock()
+
+	scheme = strings.ToLower(scheme)
+	if !schemeRe.MatchString(scheme) || loader == nil {
+		return fmt.Errorf("loader must have a valid scheme name and a non-nil Loader: %q", scheme)
+	}
+	if _, ok := loaders[scheme]; ok {
+		return fmt.Errorf("loader for scheme %q is already registered", scheme)
+	}
+	loaders[scheme] = loader
+	return nil
+}
+
+// loader returns the Loader used for a given scheme, Generator.Loaders take precedence over
+// registered loaders which in turn take precedence over the built-in loaders
+func (gen *Generator) loader(scheme string) (Loader, error) {
+	if loader, ok := gen.Loaders[scheme]; ok {
+		return loader, nil
+	}
+
+	loadersMu.RLock()
+	loader, ok := loaders[scheme]
+	loadersMu.RUnlock()
+	if ok {
+		return loader, nil
+	}
+
+	switch scheme {
+	case "file":
+		return LoaderFunc(loadFile), nil
+	case "env":
+		return LoaderFunc(loadEnv), nil
+	case "cmd":
+		return &execLoader{allow: gen.AllowExec, timeout: DefaultExecTimeout}, nil
+	case "git":
+		return gitLoader{}, nil
+	case "stdin":
+		return LoaderFunc(func(ctx context.Context, src *Source) (*Document, error) {
+			b, err := gen.stdin()
+			if err != nil {
+				return nil, err
+			}
+			return &Document{Data: b}, nil
+		}), nil
+	case "http", "https":
+		return &httpLoader{client: gen.allowRedirects(gen.httpClient()), cache: gen.httpCache(), exchanges: gen.exchangeStore()}, nil
+	}
+	return nil, fmt.Errorf("no loader registered for scheme %q", scheme)
+}
+
+// schemeRe matches a URL scheme as defined in RFC 3986
+var schemeRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*$`)
+
+// urlScheme returns the lowercase scheme of a path prefixed with "<scheme>://"
+func urlScheme(path string) (string, bool) {
+	i := strings.Index(path, "://")
+	if i < 1 || !schemeRe.MatchString(path[:i]) {
+		return "", false
+	}
+	return strings.ToLower(path[:i]), true
+}
+
+// pathScheme returns the scheme of a path, local file paths return "file"
+func pathScheme(path string) string {
+	if scheme, ok := urlScheme(path); ok {
+		return scheme
+	}
+	return "file"
+}
+
+// loadFile reads a local file, directories and glob patterns are merged into a single document
+func loadFile(ctx context.Context, src *Source) (*Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if isFileSet(src.Path) {
+		return loadFileSet(ctx, src)
+	}
+	b, err := readFile(src.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{Data: b}, nil
+}
+
+// envKeyRe matches environment variable names that can be represented in a dotenv document
+var envKeyRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.]*$`)
+
+// envEscaper escapes the characters that have a special meaning inside a double quoted dotenv value
+var envEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, `"`, `\"`, "$", `\$`)
+
+// loadEnv returns the process environment as a dotenv document,
+// every value is double quoted so that it is read back verbatim
+func loadEnv(ctx context.Context, src *Source) (*Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if !envKeyRe.MatchString(k) {
+			continue
+		}
+		lines = append(lines, k+`="`+envEscaper.Replace(v)+`"`)
+	}
+	sort.Strings(lines)
+	return &Document{Data: []byte(strings.Join(lines, "\n")), Format: Dotenv}, nil
+}
+
+// load retrieves a Source with the Loader registered for its scheme,
+// the returned Document is decrypted if encrypted is true and always has a Format:
+// Source.Format > Document.Format > suffix of Source.Path > fallback
+func (g *Gear) load(ctx context.Context, src *Source, encrypted bool, fallback Format) (*Document, error) {
+	scheme := pathScheme(src.Path)
+	if encrypted && scheme == "file" && isFileSet(src.Path) {
+		return nil, fmt.Errorf("%s: encrypted paths must reference a single file", src.Path)
+	}
+	if err := g.gen.checkSource(src); err != nil {
+		return nil, err
+	}
+	loader, err := g.gen.loader(scheme)
+	if err != nil {
+		return nil, err
+	}
+	release, err := g.gen.acquireLoad(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	// remote requests apply the timeout to each attempt
+	if _, ok := loader.(*httpLoader); !ok && src.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, src.Timeout)
+		defer cancel()
+	}
+	doc, err := loader.Load(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	// encrypted documents are locked as ciphertext
+	if err = g.lockSource(src, doc.Data); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case src.Format != "":
+		doc.Format = src.Format
+	case doc.Format == "":
+		doc.Format = FormatForPath(src.Path)
+	}
+	if doc.Format == List && fallback != "" {
+		doc.Format = fallback
+	}
+	if encrypted {
+		keys, err := g.sopsKeys()
+		if err != nil {
+			return nil, err
+		}
+		if doc.Data, err = decryptData(ctx, doc.Data, doc.Format, keys); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
@@ -0,0 +1,172 @@
+package cogs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// lockfileVersion is the version of the lockfile format written by Lockfile.Write
+const lockfileVersion = 1
+
+// Lockfile pins the SHA-256 of every source read while generating the contexts of a cog file,
+// the process environment and stdin are never locked
+type Lockfile struct {
+	Version int `json:"version"`
+	// Contexts maps a context name to the hashes of its sources: {"ctx": {"./file.yaml": "sha256:..."}}
+	Contexts map[string]map[string]string `json:"contexts"`
+}
+
+// LockfilePath returns the path of the lockfile of a cog file: <cog-file>.lock
+func LockfilePath(cogPath string) string {
+	return cogPath + ".lock"
+}
+
+// ReadLockfile reads a lockfile written by Lockfile.Write
+func ReadLockfile(lockPath string) (*Lockfile, error) {
+	b, err := readFile(lockPath)
+	if err != nil {
+		return nil, err
+	}
+	lock := &Lockfile{}
+	if err = json.Unmarshal(b, lock); err != nil {
+		return nil, fmt.Errorf("%s: %w", lockPath, err)
+	}
+	if lock.Version != lockfileVersion {
+		return nil, fmt.Errorf("%s: unsupported lockfile version %d", lockPath, lock.Version)
+	}
+	if lock.Contexts == nil {
+		lock.Contexts = make(map[string]map[string]string)
+	}
+	return lock, nil
+}
+
+// Merge replaces the contexts of l with the contexts of other
+func (l *Lockfile) Merge(other *Lockfile) {
+	if l.Contexts == nil {
+		l.Contexts = make(map[string]map[string]string)
+	}
+	for ctxName, sources := range other.Contexts {
+		l.Contexts[ctxName] = sources
+	}
+}
+
+// Write writes a lockfile with sorted keys so that it can be diffed
+func (l *Lockfile) Write(lockPath string) error {
+	l.Version = lockfileVersion
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(lockPath, append(b, '\n'), 0o644)
+}
+
+// Lockfile returns the hashes of the sources read by every Generate call of the Generator
+func (gen *Generator) Lockfile() *Lockfile {
+	gen.lockMu.Lock()
+	defer gen.lockMu.Unlock()
+
+	lock := &Lockfile{Version: lockfileVersion, Contexts: make(map[string]map[string]string)}
+	for ctxName, sources := range gen.locked {
+		lock.Contexts[ctxName] = make(map[string]string, len(sources))
+		for source, hash := range sources {
+			lock.Contexts[ctxName][source] = hash
+		}
+	}
+	return lock
+}
+
+// lockSource records the hash of the data read from a Source,
+// an error is returned if Generator.Lock is set and holds a differing hash
+func (g *Gear) lockSource(src *Source, data []byte) error {
+	switch pathScheme(src.Path) {
+	case "env", "stdin":
+		return nil
+	}
+	source := g.lockKey(src)
+	sum := sha256.Sum256(data)
+	hash := "sha256:" + hex.EncodeToString(sum[:])
+
+	gen := g.gen
+	gen.lockMu.Lock()
+	if gen.locked == nil {
+		gen.locked = make(map[string]map[string]string)
+	}
+	if gen.locked[g.lockCtx] == nil {
+		gen.locked[g.lockCtx] = make(map[string]string)
+	}
+	gen.locked[g.lockCtx][source] = hash
+	gen.lockMu.Unlock()
+
+	if gen.Lock == nil {
+		return nil
+	}
+	locked, ok := gen.Lock.Contexts[g.lockCtx][source]
+	switch {
+	case !ok:
+		return fmt.Errorf("%s: source of context %q is not locked, run `cogs lock`", source, g.lockCtx)
+	case locked != hash:
+		return fmt.Errorf("%s: content changed since it was locked: %s != %s", source, hash, locked)
+	}
+	return nil
+}
+
+// lockKey describes a Source in a lockfile, local paths are relative to the cog file passed to Generate
+func (g *Gear) lockKey(src *Source) string {
+	switch scheme := pathScheme(src.Path); scheme {
+	case "http", "https":
+		method := src.Method
+		if method == "" {
+			method = "GET"
+		}
+		key := method + " " + redactURL(src.Path)
+		// requests to a single URL are told apart by their body
+		if src.Body != "" {
+			sum := sha256.Sum256([]byte(src.ContentType + "\n" + src.Body))
+			key += " body:" + hex.EncodeToString(sum[:6])
+		}
+		// and by every other property of their path group
+		if request := requestProperties(src); request != (distinctPath{}) {
+			sum := sha256.Sum256([]byte(fmt.Sprintf("%+v", request)))
+			key += " request:" + hex.EncodeToString(sum[:6])
+		}
+		return key
+	case "cmd":
+		return "cmd://" + strings.Join(src.Command, " ") + " (" + g.relativePath(src.Dir) + ")"
+	case "file":
+		return g.relativePath(strings.TrimPrefix(src.Path, "file://"))
+	default:
+		return src.Path
+	}
+}
+
+// requestProperties returns the properties of the path group of an HTTP Source that can change its response
+// and are not already part of its lock key, the rendered body is hashed separately. Credentials are left out, auth and tls are described by
+// the settings they were read from
+func requestProperties(src *Source) distinctPath {
+	request := src.group
+	request.path, request.method, request.body = "", "", ""
+	// the timeout and retries of a request do not change its response
+	request.timeout, request.retry = 0, retryPolicy{}
+	request.header = ""
+	if header := src.Header.Clone(); len(header) > 0 {
+		header.Del("Authorization")
+		if len(header) > 0 {
+			request.header = fmt.Sprintf("%v", header)
+		}
+	}
+	return request
+}
+
+// relativePath returns a local path relative to the directory of the cog file passed to Generate
+func (g *Gear) relativePath(p string) string {
+	rel, err := filepath.Rel(filepath.Dir(g.lockRoot), p)
+	if err != nil {
+		return p
+	}
+	return filepath.ToSlash(rel)
+}
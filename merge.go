@@ -0,0 +1,100 @@
+package cogs
+
+import (
+	"fmt"
+)
+
+// MergeStrategy represents how duplicate keys are handled when CfgMaps are joined
+type MergeStrategy string
+
+// Strategies for resolving duplicate keys
+const (
+	MergeError MergeStrategy = "error" // duplicate keys return an error
+	MergeFirst MergeStrategy = "first" // the first value found for a key is kept
+	MergeLast  MergeStrategy = "last"  // the last value found for a key is kept
+	MergeDeep  MergeStrategy = "deep"  // complex map values are merged recursively, otherwise the last value is kept
+)
+
+// Validate ensures that a string maps to a valid MergeStrategy
+func (m MergeStrategy) Validate() error {
+	switch m {
+	case MergeError, MergeFirst, MergeLast, MergeDeep:
+		return nil
+	default:
+		return fmt.Errorf("%s is an invalid MergeStrategy", string(m))
+	}
+}
+
+// JoinWith merges any number of CfgMap elements into a single CfgMap,
+// duplicate key names are resolved using the provided MergeStrategy.
+func JoinWith(strategy MergeStrategy, cfgs ...*CfgMap) (CfgMap, error) {
+	if err := strategy.Validate(); err != nil {
+		return nil, err
+	}
+	c := CfgMap{}
+	for _, cfg := range cfgs {
+		for k, v := range *cfg {
+			merged, err := mergeValue(strategy, c, k, v)
+			if err != nil {
+				return nil, fmt.Errorf("duplicate key found in two contexts: %w", err)
+			}
+			c[k] = merged
+		}
+	}
+	return c, nil
+}
+
+// mergeValue returns the value that key k should hold in dst once v is merged into it
+func mergeValue(strategy MergeStrategy, dst map[string]interface{}, k string, v interface{}) (interface{}, error) {
+	old, ok := dst[k]
+	if !ok {
+		return v, nil
+	}
+	switch strategy {
+	case MergeFirst:
+		return old, nil
+	case MergeLast:
+		return v, nil
+	case MergeDeep:
+		return deepMerge(old, v), nil
+	}
+	return nil, fmt.Errorf("%q", k)
+}
+
+// deepMerge recursively merges src into dst if both hold a map value,
+// src is returned for any other pairing of types
+// neither dst nor src are modified
+func deepMerge(dst, src interface{}) interface{} {
+	dstMap, ok := asMap(dst)
+	if !ok {
+		return src
+	}
+	srcMap, ok := asMap(src)
+	if !ok {
+		return src
+	}
+
+	out := make(map[string]interface{}, len(dstMap))
+	for k, v := range dstMap {
+		out[k] = v
+	}
+	for k, v := range srcMap {
+		if old, ok := out[k]; ok {
+			out[k] = deepMerge(old, v)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// asMap returns the underlying map of a complex value
+func asMap(i interface{}) (map[string]interface{}, bool) {
+	switch t := i.(type) {
+	case map[string]interface{}:
+		return t, true
+	case CfgMap:
+		return t, true
+	}
+	return nil, false
+}
@@ -9,6 +9,9 @@ import (
 const GoTemplateDelimL = "gt{{"
 const GoTemplateDelimR = "}}gt"
 
+// GoTemplateDelimPresent is set once Generate has escaped a go template into a string
+//
+// Deprecated: only set by Generate, use Generator.GoTemplateDelimPresent instead.
 var GoTemplateDelimPresent = false
 
 func StripGoTemplateDelim(str string) string {
@@ -31,10 +34,18 @@ type Node struct {
 	inner *yaml.Node
 }
 
+// NewGoTemplateToStr escapes any go templates held in a node into strings
 func NewGoTemplateToStr(node *yaml.Node) {
+	newGoTemplateToStr(node)
+}
+
+// newGoTemplateToStr escapes any go templates held in a node into strings,
+// returning true if a go template was found
+func newGoTemplateToStr(node *yaml.Node) bool {
 	templateNode := &Node{inner: node}
-	templateNode.GoTemplateToStr()
+	found := templateNode.goTemplateToStr()
 	*node = *templateNode.inner
+	return found
 }
 
 func (n *Node) GetKeys() []*yaml.Node {
@@ -73,7 +84,14 @@ func sequenceKeys(node *yaml.Node, keys *[]*yaml.Node) {
 	}
 }
 
+// GoTemplateToStr escapes any go templates held in a node into strings
 func (n *Node) GoTemplateToStr() {
+	n.goTemplateToStr()
+}
+
+// goTemplateToStr escapes any go templates held in a node into strings,
+// returning true if a go template was found
+func (n *Node) goTemplateToStr() (found bool) {
 	keys := n.GetKeys()
 	for i, k := range keys {
 		if k.Kind == yaml.SequenceNode || k.Kind == yaml.MappingNode {
@@ -87,10 +105,10 @@ func (n *Node) GoTemplateToStr() {
 				Column:  k.Column,
 				Content: []*yaml.Node{},
 			}
-			GoTemplateDelimPresent = true
+			found = true
 		}
 	}
-
+	return found
 }
 
 func joinContent(node *yaml.Node) string {
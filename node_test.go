@@ -14,6 +14,7 @@ func TestKeys(t *testing.T) {
 		name   string
 		input  string
 		output string
+		found  bool
 	}{
 		{
 			name:   "Basic",
@@ -24,6 +25,7 @@ func TestKeys(t *testing.T) {
 			name:   "GoTemplate",
 			input:  `serviceName: {{ include "auth-mgmt.fullname" . }}`,
 			output: `serviceName: {{ include "auth-mgmt.fullname" . }}`,
+			found:  true,
 		},
 	}
 
@@ -34,7 +36,9 @@ func TestKeys(t *testing.T) {
 				t.Error(errors.Wrap(err, tc.name))
 			}
 			node := &Node{inner: rootNode}
-			node.GoTemplateToStr()
+			if found := node.goTemplateToStr(); found != tc.found {
+				t.Errorf("[%s]: expected found %t, got %t", tc.name, tc.found, found)
+			}
 
 			b, err := yaml.Marshal(node.inner)
 			if err != nil {
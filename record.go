@@ -0,0 +1,189 @@
+package cogs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// exchangeHeaders are the response headers kept by a recording
+var exchangeHeaders = []string{"Content-Type", "ETag", "Last-Modified", "Retry-After"}
+
+// ignoredHeaders are request headers that do not identify an exchange,
+// credentials are never part of a recording and conditional headers depend on the cache
+var ignoredHeaders = []string{"Authorization", "If-None-Match", "If-Modified-Since"}
+
+// exchangeStore records HTTP exchanges to a directory or replays them from it
+type exchangeStore struct {
+	dir    string
+	replay bool // serve recorded exchanges, HTTP requests are never made
+}
+
+// exchangeSecretsKey holds the Source secrets of a request context, see withExchangeSecrets
+type exchangeSecretsKey struct{}
+
+// withExchangeSecrets returns a context whose requests have the secrets of a Source redacted from their recording
+func withExchangeSecrets(ctx context.Context, src *Source) context.Context {
+	return context.WithValue(ctx, exchangeSecretsKey{}, sourceSecrets(src))
+}
+
+// exchange is a recorded HTTP response
+type exchange struct {
+	Method string              `json:"method"`
+	URL    string              `json:"url"` // URL without its password or query values, kept to ease inspection
+	Status int                 `json:"status"`
+	Header map[string][]string `json:"header,omitempty"`
+	Body   []byte              `json:"body"`
+}
+
+// exchangeTransport records or replays the exchanges of an exchangeStore
+type exchangeTransport struct {
+	next  http.RoundTripper
+	store *exchangeStore
+}
+
+// client returns a copy of client that records or replays its exchanges
+func (s *exchangeStore) client(client *http.Client) *http.Client {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	storeClient := *client
+	storeClient.Transport = &exchangeTransport{next: next, store: s}
+	return &storeClient
+}
+
+// exchangeKey hashes the method, URL, headers, and body of a request
+func exchangeKey(req *http.Request, body []byte) string {
+	u := *req.URL
+	u.User = nil
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", req.Method, u.String())
+	keys := Keys(req.Header)
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !InList(http.CanonicalHeaderKey(k), ignoredHeaders) {
+			fmt.Fprintf(h, "%s: %s\n", k, strings.Join(req.Header[k], ", "))
+		}
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// RoundTrip satisfies the http.RoundTripper interface
+func (t *exchangeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	key := exchangeKey(req, body)
+	file := filepath.Join(t.store.dir, key+".json")
+
+	if t.store.replay {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("replay: no recording of %s %s: %w", req.Method, redactURL(req.URL.String()), err)
+		}
+		recorded := &exchange{}
+		if err = json.Unmarshal(b, recorded); err != nil {
+			return nil, fmt.Errorf("replay: %s: %w", file, err)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+			StatusCode:    recorded.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header(recorded.Header),
+			Body:          io.NopCloser(bytes.NewReader(recorded.Body)),
+			ContentLength: int64(len(recorded.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	// a full response is always recorded
+	req = req.Clone(req.Context())
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	recorded := &exchange{
+		Method: req.Method,
+		URL:    redactQuery(req.URL),
+		Status: resp.StatusCode,
+		Header: make(map[string][]string),
+	}
+	secrets, _ := req.Context().Value(exchangeSecretsKey{}).([]string)
+	recorded.Body = redactCredentials(respBody, secrets, req.Header.Get("Authorization"))
+	for _, k := range exchangeHeaders {
+		if v := resp.Header.Values(k); len(v) > 0 {
+			recorded.Header[k] = v
+		}
+	}
+	b, err := json.MarshalIndent(recorded, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(t.store.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("record: %w", err)
+	}
+	if err = os.WriteFile(file, b, 0o600); err != nil {
+		return nil, fmt.Errorf("record: %w", err)
+	}
+	return resp, nil
+}
+
+// redactCredentials removes the secrets of a Source and the credentials of an Authorization header
+// from a recorded body
+func redactCredentials(body []byte, secrets []string, authorization string) []byte {
+	if authorization != "" {
+		_, credentials, ok := strings.Cut(authorization, " ")
+		if !ok || credentials == "" {
+			credentials = authorization
+		}
+		secrets = append([]string{credentials}, secrets...)
+		sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	}
+	return []byte(redactSecrets(string(body), secrets))
+}
+
+// redactQuery returns a URL without its password or query values, query values often hold tokens
+func redactQuery(u *url.URL) string {
+	redacted := *u
+	if query := redacted.Query(); len(query) > 0 {
+		keys := Keys(query)
+		sort.Strings(keys)
+		pairs := make([]string, 0, len(keys))
+		for _, k := range keys {
+			for range query[k] {
+				pairs = append(pairs, url.QueryEscape(k)+"="+redactedText)
+			}
+		}
+		redacted.RawQuery = strings.Join(pairs, "&")
+	}
+	return redacted.Redacted()
+}
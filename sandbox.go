@@ -0,0 +1,153 @@
+package cogs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// withinRoot returns an error if a local path resolves outside of Generator.Root,
+// symbolic links are followed so that they cannot be used to escape the root
+func (gen *Generator) withinRoot(filePath string) error {
+	if gen.Root == "" {
+		return nil
+	}
+	root, err := resolvePath(gen.Root)
+	if err != nil {
+		return fmt.Errorf("root: %w", err)
+	}
+	resolved, err := resolvePath(filePath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s: %w %s", filePath, ErrOutsideRoot, gen.Root)
+	}
+	return nil
+}
+
+// resolvePath returns the absolute path of a local path with every symbolic link evaluated,
+// the missing trailing elements of a path that does not exist are kept as is
+func resolvePath(filePath string) (string, error) {
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(abs)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		parent := filepath.Dir(abs)
+		if !errors.Is(err, fs.ErrNotExist) || parent == abs {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(abs)}, missing...)
+		abs = parent
+	}
+}
+
+// allowURL returns an error if the host of a URL matches none of the Generator.AllowURL patterns,
+// every URL is allowed if there are no patterns
+func (gen *Generator) allowURL(rawURL string) error {
+	if len(gen.AllowURL) == 0 {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range gen.AllowURL {
+		pattern = strings.ToLower(pattern)
+		// patterns holding a port only match that port
+		host := strings.ToLower(u.Hostname())
+		if strings.Contains(pattern, ":") {
+			host = strings.ToLower(u.Host)
+		}
+		if ok, _ := path.Match(pattern, host); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %w", redactURL(rawURL), ErrURLNotAllowed)
+}
+
+// allowRedirects returns a copy of client that only follows redirects to allowed URLs
+func (gen *Generator) allowRedirects(client *http.Client) *http.Client {
+	if len(gen.AllowURL) == 0 {
+		return client
+	}
+	checkRedirect := client.CheckRedirect
+	allowed := *client
+	allowed.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := gen.allowURL(req.URL.String()); err != nil {
+			return err
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		// the default policy of http.Client
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &allowed
+}
+
+// checkSource returns an error if a Source reads a local path outside of Generator.Root
+// or requests a URL that is not allowed, paths of custom schemes are left to their Loader.
+// Commands can read any file, and the objects of a git repository can be stored outside of it
+// through a .git file or alternates, so both are rejected if Generator.Root is set
+func (gen *Generator) checkSource(src *Source) error {
+	switch scheme := pathScheme(src.Path); scheme {
+	case "http", "https":
+		return gen.allowURL(src.Path)
+	case "cmd":
+		if gen.Root != "" {
+			return ErrCmdWithRoot
+		}
+	case "git":
+		if gen.Root != "" {
+			return ErrGitWithRoot
+		}
+	case "file":
+		if gen.Root == "" {
+			return nil
+		}
+		filePath := strings.TrimPrefix(src.Path, "file://")
+		if err := gen.withinRoot(filePath); err != nil {
+			return err
+		}
+		if !isFileSet(filePath) {
+			return nil
+		}
+		// the files of a directory or glob can be symbolic links
+		files, err := fileSet(filePath)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err = gen.withinRoot(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// localPath returns the path of a file referenced by a cog file,
+// an error is returned if it is outside of Generator.Root
+func (g *Gear) localPath(linkPath string) (string, error) {
+	filePath := g.getLinkFilePath(linkPath)
+	if err := g.gen.withinRoot(filePath); err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
@@ -0,0 +1,247 @@
+package cogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/stoewer/go-strcase"
+	"go.uber.org/multierr"
+)
+
+// ValidateSchema validates a CfgMap against the local JSON Schema found at schemaPath.
+// Every failing value is reported with its JSON pointer, links is used to report
+// the Link each failing top level key was resolved from and may be nil
+func ValidateSchema(schemaPath string, cfgMap CfgMap, links map[string]*Link) error {
+	schema, err := jsonschema.NewCompiler().Compile(schemaPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", schemaPath, err)
+	}
+
+	// round trip through JSON so that the validator only ever sees JSON types
+	b, err := json.Marshal(cfgMap)
+	if err != nil {
+		return fmt.Errorf("%s: %w", schemaPath, err)
+	}
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err = decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("%s: %w", schemaPath, err)
+	}
+
+	err = schema.Validate(doc)
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return err
+	}
+
+	var leaves []*jsonschema.ValidationError
+	schemaLeaves(validationErr, &leaves)
+	sort.SliceStable(leaves, func(i, j int) bool {
+		return leaves[i].InstanceLocation < leaves[j].InstanceLocation
+	})
+
+	var errs error
+	for _, leaf := range leaves {
+		pointer := leaf.InstanceLocation
+		if pointer == "" {
+			pointer = "/"
+		}
+		errMsg := pointer + ": " + leaf.Message
+		if link, ok := links[pointerKey(leaf.InstanceLocation)]; ok {
+			errMsg += "\n      " + link.KeyName + ": " + link.source()
+		}
+		errs = multierr.Append(errs, fmt.Errorf("%s", errMsg))
+	}
+	return fmt.Errorf("%s: %+v", schemaPath, errs)
+}
+
+// schemaLeaves collects the innermost causes of a ValidationError
+func schemaLeaves(err *jsonschema.ValidationError, leaves *[]*jsonschema.ValidationError) {
+	if len(err.Causes) == 0 {
+		*leaves = append(*leaves, err)
+		return
+	}
+	for _, cause := range err.Causes {
+		schemaLeaves(cause, leaves)
+	}
+}
+
+// pointerKey returns the unescaped top level key of a JSON pointer: "/a~1b/c" -> "a/b"
+func pointerKey(pointer string) string {
+	key := strings.SplitN(strings.TrimPrefix(pointer, "/"), "/", 2)[0]
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(key)
+}
+
+// InferSchema returns a JSON Schema describing every key of a CfgMap,
+// types are inferred from the resolved values. links is used to refine types
+// using the read type of each key and to describe where each key is resolved from, it may be nil
+func InferSchema(cfgMap CfgMap, links map[string]*Link) map[string]interface{} {
+	schema := inferSchema(map[string]interface{}(cfgMap))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+
+	properties := schema["properties"].(map[string]interface{})
+	for k, prop := range properties {
+		link, ok := links[k]
+		if !ok {
+			continue
+		}
+		propSchema := prop.(map[string]interface{})
+		switch {
+		case link.readType == rRaw:
+			propSchema["type"] = "string"
+		case link.Value == nil && link.readType.isComplex() && link.readType != rWhole:
+			propSchema["type"] = "object"
+		}
+		if link.Path != "" {
+			propSchema["description"] = "resolved from " + link.source()
+		}
+	}
+	return schema
+}
+
+// inferSchema returns the JSON Schema of a single value
+func inferSchema(v interface{}) map[string]interface{} {
+	switch t := v.(type) {
+	case nil:
+		return map[string]interface{}{}
+	case string:
+		return map[string]interface{}{"type": "string"}
+	case bool:
+		return map[string]interface{}{"type": "boolean"}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return map[string]interface{}{"type": "integer"}
+	case float32, float64:
+		return map[string]interface{}{"type": "number"}
+	case []interface{}:
+		schema := map[string]interface{}{"type": "array"}
+		var items map[string]interface{}
+		for i, el := range t {
+			elSchema := inferSchema(el)
+			if i == 0 {
+				items = elSchema
+				continue
+			}
+			// only describe items if every element shares the same schema
+			if !reflect.DeepEqual(items, elSchema) {
+				items = nil
+				break
+			}
+		}
+		if items != nil {
+			schema["items"] = items
+		}
+		return schema
+	}
+
+	if m, ok := asMap(v); ok {
+		properties := make(map[string]interface{})
+		required := []string{}
+		for k, el := range m {
+			properties[k] = inferSchema(el)
+			required = append(required, k)
+		}
+		sort.Strings(required)
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		}
+	}
+	return map[string]interface{}{}
+}
+
+// GoStruct returns the Go type definition of a JSON Schema produced by InferSchema,
+// objects are represented as structs with `mapstructure` tags
+func GoStruct(name string, schema map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	buf.WriteString("type " + goFieldName(name) + " ")
+	writeGoType(&buf, schema)
+	buf.WriteString("\n")
+
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("GoStruct: %w", err)
+	}
+	return string(b), nil
+}
+
+// writeGoType writes the Go type of a JSON Schema to buf
+func writeGoType(buf *bytes.Buffer, schema map[string]interface{}) {
+	switch schema["type"] {
+	case "string":
+		buf.WriteString("string")
+	case "boolean":
+		buf.WriteString("bool")
+	case "integer":
+		buf.WriteString("int64")
+	case "number":
+		buf.WriteString("float64")
+	case "array":
+		buf.WriteString("[]")
+		items, ok := schema["items"].(map[string]interface{})
+		if !ok {
+			items = map[string]interface{}{}
+		}
+		writeGoType(buf, items)
+	case "object":
+		properties, ok := schema["properties"].(map[string]interface{})
+		if !ok {
+			buf.WriteString("map[string]interface{}")
+			return
+		}
+		keys := Keys(properties)
+		sort.Strings(keys)
+		fields := make(map[string]string, len(keys))
+		used := make(map[string]bool, len(keys))
+		for _, k := range keys {
+			fields[k] = goFieldName(k)
+		}
+		// field names of keys that share an identifier are suffixed with the first free number
+		for _, k := range keys {
+			field := fields[k]
+			for i := 2; used[field]; i++ {
+				field = fmt.Sprintf("%s%d", fields[k], i)
+			}
+			fields[k] = field
+			used[field] = true
+		}
+
+		buf.WriteString("struct {\n")
+		for _, k := range keys {
+			field := fields[k]
+			buf.WriteString(field + " ")
+			writeGoType(buf, properties[k].(map[string]interface{}))
+			fmt.Fprintf(buf, " `mapstructure:%q`\n", k)
+		}
+		buf.WriteString("}")
+	default:
+		buf.WriteString("interface{}")
+	}
+}
+
+// goFieldName converts a key name into an exported Go identifier
+func goFieldName(k string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, k)
+	runes := []rune(strcase.UpperCamelCase(name))
+	if len(runes) > 0 {
+		// strcase only changes the case of ASCII letters
+		runes[0] = unicode.ToUpper(runes[0])
+	}
+	if len(runes) == 0 || !unicode.IsUpper(runes[0]) {
+		runes = append([]rune("X"), runes...)
+	}
+	return string(runes)
+}
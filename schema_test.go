@@ -0,0 +1,159 @@
+package cogs
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidateSchema(t *testing.T) {
+	const schemaPath = "./test_files/constrained.schema.json"
+	testCases := []struct {
+		name   string
+		cfgMap CfgMap
+		links  map[string]*Link
+		err    error
+	}{
+		{
+			name:   "Valid",
+			cfgMap: CfgMap{"port": int64(8080), "url": "https://example.com", "env": "dev"},
+		},
+		{
+			name:   "Invalid/Source",
+			cfgMap: CfgMap{"port": int64(80), "url": "https://example.com", "env": "staging"},
+			links: map[string]*Link{
+				"port": {KeyName: "port"},
+				"env":  {KeyName: "env", Path: "./envs.yaml", SubPath: ".env"},
+			},
+			err: fmt.Errorf("%s: %s", schemaPath, "the following errors occurred:\n"+
+				" -  /env: value must be one of \"dev\", \"qa\", \"prod\"\n"+
+				"          env: [\"./envs.yaml\", \".env\"]\n"+
+				" -  /port: must be >= 1024 but found 80\n"+
+				"          port: cog file value"),
+		},
+		{
+			name:   "Missing",
+			cfgMap: CfgMap{"port": int64(8080)},
+			err:    fmt.Errorf("%s: %s", schemaPath, "/: missing properties: 'url', 'env'"),
+		},
+		{
+			// values converted to strings by OutputCfg do not match their schema type
+			name:   "StringifiedValue",
+			cfgMap: CfgMap{"port": "8080", "url": "https://example.com", "env": "dev"},
+			err:    fmt.Errorf("%s: %s", schemaPath, "/port: expected integer, but got string"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateSchema(schemaPath, tc.cfgMap, tc.links)
+			if diff := cmp.Diff(fmt.Sprint(tc.err), fmt.Sprint(err)); diff != "" {
+				t.Errorf("(-expected err +actual err)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGenerateSchemaOutputType(t *testing.T) {
+	schemaPath, err := filepath.Abs("./test_files/constrained.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cogPath := filepath.Join(t.TempDir(), "schema.cog.toml")
+	cogToml := fmt.Sprintf(`name = "schema"
+[schema]
+schema = %q
+[schema.vars]
+port = 8080
+url = "https://example.com"
+env = "dev"
+`, schemaPath)
+	if err = os.WriteFile(cogPath, []byte(cogToml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the resolved values are validated before they are converted to the output type
+	for _, format := range []Format{JSON, Dotenv, List} {
+		t.Run(string(format), func(t *testing.T) {
+			gen := NewGenerator()
+			gen.OutputType = format
+			if _, err := gen.Generate("schema", cogPath); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// update rewrites the golden files of schema tests: go test -run 'Schema|GoStruct' -update
+var update = flag.Bool("update", false, "update golden files")
+
+// golden compares got with the golden file at path, the file is rewritten if -update is set
+func golden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), string(got)); diff != "" {
+		t.Errorf("%s mismatch (-want +got):\n%s", path, diff)
+	}
+}
+
+// goldenCfgMap holds nested maps, arrays of a single type, mixed type arrays,
+// and key names that are not valid Go identifiers
+var goldenCfgMap = CfgMap{
+	"name":    "cogs",
+	"port":    int64(8080),
+	"ratio":   0.5,
+	"enabled": true,
+	"empty":   nil,
+	"database": map[string]interface{}{
+		"host": "localhost",
+		"replicas": []interface{}{
+			map[string]interface{}{"host": "replica-1", "port": int64(5432)},
+			map[string]interface{}{"host": "replica-2", "port": int64(5433)},
+		},
+		"options": map[string]interface{}{"ssl": true},
+	},
+	"tags":        []interface{}{"a", "b"},
+	"mixed":       []interface{}{"a", int64(1), true},
+	"nested_list": []interface{}{[]interface{}{int64(1)}, []interface{}{int64(2)}},
+	"none":        []interface{}{},
+	"api-key":     "secret",
+	"api_key":     "secret",
+	"api key 2":   "secret",
+	"名前":          "name",
+	"2fa":         false,
+	"user.name":   "admin",
+	"ümlaut":      "ü",
+	"_":           "underscore",
+}
+
+func TestInferSchema(t *testing.T) {
+	links := map[string]*Link{
+		"name": {KeyName: "name", Path: "./manifest.yaml", SubPath: ".name"},
+		"port": {KeyName: "port"},
+	}
+	b, err := json.MarshalIndent(InferSchema(goldenCfgMap, links), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "./test_files/golden/inferred.schema.json", append(b, '\n'))
+}
+
+func TestGoStruct(t *testing.T) {
+	src, err := GoStruct("golden config", InferSchema(goldenCfgMap, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "./test_files/golden/inferred.go.golden", []byte(src))
+}
@@ -0,0 +1,150 @@
+package cogs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+	ageArmor "filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgpArmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/mitchellh/mapstructure"
+	"go.mozilla.org/sops/v3/keyservice"
+)
+
+// sopsSettings selects the keys that decrypt SOPS documents instead of the keys found
+// through SOPS_AGE_KEY_FILE, GNUPGHOME, and the gpg binary
+type sopsSettings struct {
+	AgeKeyFile string `mapstructure:"age_key_file"`
+	PGPKeyring string `mapstructure:"pgp_keyring"` // armored or binary keyring holding private keys
+}
+
+// parseSops decodes and validates a sops table
+func parseSops(v interface{}) (*sopsSettings, error) {
+	rawSops, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be a table: %T", v)
+	}
+	settings := &sopsSettings{}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{ErrorUnused: true, Result: settings})
+	if err != nil {
+		return nil, err
+	}
+	if err = decoder.Decode(rawSops); err != nil {
+		return nil, err
+	}
+	if *settings == (sopsSettings{}) {
+		return nil, fmt.Errorf("one of age_key_file or pgp_keyring must be defined")
+	}
+	return settings, nil
+}
+
+// sopsKeys returns the key files used to decrypt the documents of a Gear, nil if ambient keys are used.
+// Files of the sops context key are relative to the cog file and take precedence over the Generator
+func (g *Gear) sopsKeys() (*sopsSettings, error) {
+	settings := sopsSettings{AgeKeyFile: g.gen.AgeKeyFile, PGPKeyring: g.gen.PGPKeyring}
+	if g.sops != nil {
+		var err error
+		if g.sops.AgeKeyFile != "" {
+			if settings.AgeKeyFile, err = g.localPath(g.sops.AgeKeyFile); err != nil {
+				return nil, fmt.Errorf("sops.age_key_file: %w", err)
+			}
+		}
+		if g.sops.PGPKeyring != "" {
+			if settings.PGPKeyring, err = g.localPath(g.sops.PGPKeyring); err != nil {
+				return nil, fmt.Errorf("sops.pgp_keyring: %w", err)
+			}
+		}
+	}
+	if settings == (sopsSettings{}) {
+		return nil, nil
+	}
+	return &settings, nil
+}
+
+// sopsKeyService decrypts the data keys of age and PGP master keys with the identities read from sopsSettings,
+// every other master key is decrypted by the default sops key service
+type sopsKeyService struct {
+	ageIdentities []age.Identity
+	pgpKeyring    openpgp.EntityList
+	fallback      keyservice.Server
+}
+
+// newKeyService reads the key files of sopsSettings
+func newKeyService(settings *sopsSettings) (*sopsKeyService, error) {
+	ks := &sopsKeyService{}
+	if settings.AgeKeyFile != "" {
+		b, err := readFile(settings.AgeKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("age_key_file: %w", err)
+		}
+		if ks.ageIdentities, err = age.ParseIdentities(bytes.NewReader(b)); err != nil {
+			return nil, fmt.Errorf("age_key_file: %s: %w", settings.AgeKeyFile, err)
+		}
+	}
+	if settings.PGPKeyring != "" {
+		b, err := readFile(settings.PGPKeyring)
+		if err != nil {
+			return nil, fmt.Errorf("pgp_keyring: %w", err)
+		}
+		if ks.pgpKeyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(b)); err != nil {
+			if ks.pgpKeyring, err = openpgp.ReadKeyRing(bytes.NewReader(b)); err != nil {
+				return nil, fmt.Errorf("pgp_keyring: %s: %w", settings.PGPKeyring, err)
+			}
+		}
+	}
+	return ks, nil
+}
+
+// Decrypt satisfies the keyservice.KeyServiceServer interface
+func (ks *sopsKeyService) Decrypt(ctx context.Context, req *keyservice.DecryptRequest) (*keyservice.DecryptResponse, error) {
+	var plaintext []byte
+	var err error
+	switch req.Key.GetKeyType().(type) {
+	case *keyservice.Key_AgeKey:
+		if ks.ageIdentities == nil {
+			return ks.fallback.Decrypt(ctx, req)
+		}
+		plaintext, err = ks.decryptAge(req.Ciphertext)
+	case *keyservice.Key_PgpKey:
+		if ks.pgpKeyring == nil {
+			return ks.fallback.Decrypt(ctx, req)
+		}
+		plaintext, err = ks.decryptPGP(req.Ciphertext)
+	default:
+		return ks.fallback.Decrypt(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &keyservice.DecryptResponse{Plaintext: plaintext}, nil
+}
+
+// Encrypt satisfies the keyservice.KeyServiceServer interface, cogs never encrypts data keys
+func (ks *sopsKeyService) Encrypt(ctx context.Context, req *keyservice.EncryptRequest) (*keyservice.EncryptResponse, error) {
+	return nil, fmt.Errorf("sops: encryption is not supported")
+}
+
+// decryptAge decrypts an armored age data key
+func (ks *sopsKeyService) decryptAge(ciphertext []byte) ([]byte, error) {
+	r, err := age.Decrypt(ageArmor.NewReader(bytes.NewReader(ciphertext)), ks.ageIdentities...)
+	if err != nil {
+		return nil, fmt.Errorf("age_key_file: %w", err)
+	}
+	return io.ReadAll(r)
+}
+
+// decryptPGP decrypts an armored PGP data key, keys protected by a passphrase are not supported
+func (ks *sopsKeyService) decryptPGP(ciphertext []byte) ([]byte, error) {
+	block, err := pgpArmor.Decode(bytes.NewReader(ciphertext))
+	if err != nil {
+		return nil, fmt.Errorf("pgp_keyring: %w", err)
+	}
+	md, err := openpgp.ReadMessage(block.Body, ks.pgpKeyring, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("pgp_keyring: %w", err)
+	}
+	return io.ReadAll(md.UnverifiedBody)
+}
@@ -0,0 +1,111 @@
+package cogs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// tlsSettings describes the TLS configuration of HTTP requests,
+// file paths are relative to the cog file: tls = {ca = "./ca.pem", cert = "./client.pem", key = "./client-key.pem"}
+type tlsSettings struct {
+	CA         string `mapstructure:"ca"`          // PEM bundle of the certificate authorities trusted instead of the system pool
+	Cert       string `mapstructure:"cert"`        // PEM client certificate
+	Key        string `mapstructure:"key"`         // PEM key of the client certificate
+	ServerName string `mapstructure:"server_name"` // host name used to verify the server certificate
+}
+
+// parseTLS decodes and validates a tls table
+func parseTLS(v interface{}) (*tlsSettings, error) {
+	rawTLS, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be a table: %T", v)
+	}
+	settings := &tlsSettings{}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{ErrorUnused: true, Result: settings})
+	if err != nil {
+		return nil, err
+	}
+	if err = decoder.Decode(rawTLS); err != nil {
+		return nil, err
+	}
+	if (settings.Cert == "") != (settings.Key == "") {
+		return nil, fmt.Errorf("cert and key must be defined together")
+	}
+	if *settings == (tlsSettings{}) {
+		return nil, fmt.Errorf("one of ca, cert, key, or server_name must be defined")
+	}
+	return settings, nil
+}
+
+// String describes tlsSettings so that it can be used to group Links
+func (t *tlsSettings) String() string {
+	if t == nil {
+		return ""
+	}
+	return fmt.Sprintf("%+v", *t)
+}
+
+// tlsConfig reads the files of tlsSettings relative to the cog file
+func (g *Gear) tlsConfig(settings *tlsSettings) (*tls.Config, error) {
+	if settings == nil {
+		return nil, nil
+	}
+	config := &tls.Config{
+		ServerName: settings.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if settings.CA != "" {
+		caPath, err := g.localPath(settings.CA)
+		if err != nil {
+			return nil, fmt.Errorf("tls.ca: %w", err)
+		}
+		b, err := readFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("tls.ca: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("tls.ca: %s does not contain a PEM certificate", caPath)
+		}
+	}
+	if settings.Cert != "" {
+		certPath, err := g.localPath(settings.Cert)
+		if err != nil {
+			return nil, fmt.Errorf("tls.cert: %w", err)
+		}
+		keyPath, err := g.localPath(settings.Key)
+		if err != nil {
+			return nil, fmt.Errorf("tls.key: %w", err)
+		}
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("tls.cert: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// tlsClient returns a copy of client using a transport with the given TLS configuration,
+// an error is returned if the transport of client is not an *http.Transport
+// since its TLS configuration cannot be replaced
+func tlsClient(client *http.Client, config *tls.Config) (*http.Client, error) {
+	roundTripper := client.Transport
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+	transport, ok := roundTripper.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrTLSTransport, roundTripper)
+	}
+	transport = transport.Clone()
+	transport.TLSClientConfig = config
+
+	tlsClient := *client
+	tlsClient.Transport = transport
+	return &tlsClient, nil
+}
@@ -0,0 +1,110 @@
+package cogs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Transform modifies the resolved value of a Link, transforms are applied in the order
+// they are listed in the `transform` key: var.transform = ["b64decode", "trim"]
+type Transform func(interface{}) (interface{}, error)
+
+var (
+	transformsMu sync.RWMutex
+	transforms   = map[string]Transform{
+		"b64decode": stringTransform(b64Decode),
+		"b64encode": stringTransform(func(s string) (string, error) {
+			return base64.StdEncoding.EncodeToString([]byte(s)), nil
+		}),
+		"trim": stringTransform(func(s string) (string, error) {
+			return strings.TrimSpace(s), nil
+		}),
+		"lower": stringTransform(func(s string) (string, error) {
+			return strings.ToLower(s), nil
+		}),
+		"upper": stringTransform(func(s string) (string, error) {
+			return strings.ToUpper(s), nil
+		}),
+		"json": jsonEncode,
+	}
+)
+
+// RegisterTransform makes a Transform available under the given name,
+// registering a name that is already in use returns an error
+func RegisterTransform(name string, fn Transform) error {
+	transformsMu.Lock()
+	defer transformsMu.Unlock()
+
+	if name == "" || fn == nil {
+		return fmt.Errorf("transform must have a non-empty name and a non-nil function")
+	}
+	if _, ok := transforms[name]; ok {
+		return fmt.Errorf("transform %q is already registered", name)
+	}
+	transforms[name] = fn
+	return nil
+}
+
+// getTransform returns the registered Transform for a given name
+func getTransform(name string) (Transform, error) {
+	transformsMu.RLock()
+	defer transformsMu.RUnlock()
+
+	fn, ok := transforms[name]
+	if !ok {
+		return nil, fmt.Errorf("%q is not a registered transform", name)
+	}
+	return fn, nil
+}
+
+// applyTransforms passes Link.Value through each of the Link's transforms in order
+func applyTransforms(link *Link) error {
+	if link.omitted() {
+		return nil
+	}
+	for i, name := range link.transforms {
+		fn, err := getTransform(name)
+		if err != nil {
+			return fmt.Errorf("%s.transform[%d]: %w", link.KeyName, i, err)
+		}
+		if link.Value, err = fn(link.Value); err != nil {
+			return fmt.Errorf("%s.transform[%d]: %s: %w", link.KeyName, i, name, err)
+		}
+	}
+	return nil
+}
+
+// stringTransform wraps a string function so that it can be applied to any simple value
+func stringTransform(fn func(string) (string, error)) Transform {
+	return func(i interface{}) (interface{}, error) {
+		str, err := SimpleValueToString(i)
+		if err != nil {
+			return nil, err
+		}
+		return fn(str)
+	}
+}
+
+// b64Decode decodes standard base64, line breaks are ignored and padding is optional
+func b64Decode(s string) (string, error) {
+	s = strings.Join(strings.Fields(s), "")
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		if b, err = base64.RawStdEncoding.DecodeString(s); err != nil {
+			return "", err
+		}
+	}
+	return string(b), nil
+}
+
+// jsonEncode serializes any value into a JSON string
+func jsonEncode(i interface{}) (interface{}, error) {
+	b, err := json.Marshal(i)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,75 @@
+package cogs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestApplyTransforms(t *testing.T) {
+	if err := RegisterTransform("reverse", func(i interface{}) (interface{}, error) {
+		runes := []rune(fmt.Sprint(i))
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		transformsMu.Lock()
+		delete(transforms, "reverse")
+		transformsMu.Unlock()
+	})
+	if err := RegisterTransform("trim", jsonEncode); err == nil {
+		t.Errorf("expected duplicate transform name to return an error")
+	}
+
+	testCases := []struct {
+		name   string
+		link   *Link
+		output interface{}
+		err    error
+	}{
+		{
+			name:   "Pipeline",
+			link:   &Link{KeyName: "cert", Value: "  aGVsbG8K\n", transforms: []string{"b64decode", "trim", "upper"}},
+			output: "HELLO",
+		},
+		{
+			name:   "SimpleValue",
+			link:   &Link{KeyName: "port", Value: int64(8080), transforms: []string{"b64encode", "b64decode"}},
+			output: "8080",
+		},
+		{
+			name:   "JSON",
+			link:   &Link{KeyName: "map", Value: map[string]interface{}{"k": []interface{}{"v"}}, transforms: []string{"json"}},
+			output: `{"k":["v"]}`,
+		},
+		{
+			name:   "Custom",
+			link:   &Link{KeyName: "var", Value: "abc", transforms: []string{"reverse"}},
+			output: "cba",
+		},
+		{
+			name: "ComplexValue/Error",
+			link: &Link{KeyName: "map", Value: map[string]interface{}{}, transforms: []string{"lower"}},
+			err:  fmt.Errorf("map.transform[0]: lower: map[] of type map[string]interface {} is not a simple value"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := applyTransforms(tc.link)
+			if diff := cmp.Diff(fmt.Sprint(tc.err), fmt.Sprint(err)); diff != "" {
+				t.Errorf("(-expected err +actual err)\n%s", diff)
+			}
+			if tc.err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.output, tc.link.Value); diff != "" {
+				t.Errorf("(-expected value +actual value)\n%s", diff)
+			}
+		})
+	}
+}